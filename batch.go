@@ -0,0 +1,87 @@
+// Copyright 2015 to Paweł Szczur.  All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bytering
+
+// maxBatchSize is the largest size of a BatchWriter buffer.
+const maxBatchSize = 4096
+
+// BatchWriter collects small writes and passes them into a ByteRing with a
+// single Write, so the lock is taken once per batch. It's created by Batch.
+// Data is written when the buffer of BatchWriter is full or on Flush, the
+// caller must call Flush after the last write. A BatchWriter must not be
+// used by more than one goroutine at a time.
+type BatchWriter struct {
+	b   *ByteRing
+	buf []byte
+}
+
+// Batch returns a BatchWriter writing into buffer. Its buffer holds Size()
+// bytes, but at most 4KiB.
+func (b *ByteRing) Batch() *BatchWriter {
+	return &BatchWriter{
+		b:   b,
+		buf: make([]byte, 0, min(b.Size(), maxBatchSize)),
+	}
+}
+
+// Write appends p to the batch. If p doesn't fit, the batch is flushed first.
+// Data larger than the whole batch is written directly.
+func (w *BatchWriter) Write(p []byte) (int, error) {
+	if len(w.buf)+len(p) > cap(w.buf) {
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+		if len(p) > cap(w.buf) {
+			return w.b.Write(p)
+		}
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+// WriteString works like Write but accepts a string.
+func (w *BatchWriter) WriteString(s string) (int, error) {
+	if len(w.buf)+len(s) > cap(w.buf) {
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+		if len(s) > cap(w.buf) {
+			return w.b.WriteString(s)
+		}
+	}
+	w.buf = append(w.buf, s...)
+	return len(s), nil
+}
+
+// WriteByte appends a single byte to the batch.
+func (w *BatchWriter) WriteByte(c byte) error {
+	if len(w.buf) == cap(w.buf) {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if cap(w.buf) == 0 {
+			return w.b.WriteByte(c)
+		}
+	}
+	w.buf = append(w.buf, c)
+	return nil
+}
+
+// Buffered returns the number of bytes waiting for Flush.
+func (w *BatchWriter) Buffered() int {
+	return len(w.buf)
+}
+
+// Flush writes the batch into the ByteRing. If the write fails, e.g. with
+// io.ErrShortWrite in lossless mode, bytes which were not written stay in
+// the batch.
+func (w *BatchWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	n, err := w.b.Write(w.buf)
+	w.buf = w.buf[:copy(w.buf, w.buf[n:])]
+	return err
+}
@@ -8,135 +8,1526 @@
 //
 // The ByteRing structure is thread safe.
 //
+// ByteRing can also be used as a bounded FIFO queue: Read consumes the oldest
+// unread bytes. Writing into a full ring overwrites the oldest unread data.
+// It implements io.ReadWriteCloser: Write appends, Read consumes the oldest
+// bytes and Close ends the stream, later writes fail while remaining data can
+// be still read.
+//
 // Example code:
-// 	buf := NewByteRing(10)
-// 	buf.Write([]byte("Tutaj"))
-// 	buf.Write([]byte("jest"))
-// 	buf.Write([]byte("tekst."))
-// 	d = make([]byte, 10)
-// 	buf.WriteTo(d) // d will contain "jesttekst."
+//
+//	buf := NewByteRing(10)
+//	buf.Write([]byte("Tutaj"))
+//	buf.Write([]byte("jest"))
+//	buf.Write([]byte("tekst."))
+//	d = make([]byte, 10)
+//	buf.WriteTo(d) // d will contain "jesttekst."
 package bytering
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"iter"
+	"net"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"unsafe"
 )
 
+// ErrInvalidUnreadByte is returned by UnreadByte when there is no previously
+// read byte which is still held in buffer.
+var ErrInvalidUnreadByte = errors.New("bytering: invalid use of UnreadByte")
+
+// ErrClosed is returned by writes into a closed ByteRing.
+var ErrClosed = errors.New("bytering: write to closed ByteRing")
+
+// ErrPeekLost is returned by Commit if bytes returned by PeekN are no longer
+// the oldest unread bytes, because they were overwritten or consumed.
+var ErrPeekLost = errors.New("bytering: peeked data was lost")
+
+var errNegativeOffset = errors.New("bytering: negative offset")
+
+var errNegativeSize = errors.New("bytering: negative size")
+
+var errInvalidBinary = errors.New("bytering: invalid binary data")
+
+var errOutOfRange = errors.New("bytering: index out of range")
+
 type ByteRing struct {
-	b    []byte
-	end  int
-	full bool
+	b        []byte
+	start    int // points to the oldest unread element
+	end      int // points to the last element+1 wraped by size
+	full     bool
+	behind   int // number of read bytes before start which are still intact
 	capacity int
 
-	m sync.RWMutex
+	written uint64 // total number of bytes passed to write methods
+	dropped uint64 // number of bytes overwritten or not stored at all
+	epoch   uint64 // changed when data is moved other than by reads and writes
+	gen     uint64 // changed when unread data is dropped, see Generation
+
+	peeked   int    // number of bytes returned by PeekN, see Commit
+	peekGen  uint64 // gen at the time of PeekN
+	peekPos  uint64 // written - available() at the time of PeekN
+	peekLost bool   // peeked bytes were overwritten by WriteAt
+
+	onOverflow  func(dropped []byte)
+	onFull      func()
+	fullFired   bool // onFull was called since the last reset
+	observer    Observer
+	pending     observed // events not yet passed to observer
+	zeroOnReset bool
+	lossless    bool // never overwrite unread data, see WithLossless
+	maxGrow     int  // grow up to this size instead of overwriting, see WithAutoGrow
+	lines       lineIndex
+	readChunk   int       // default chunk size of ReadFrom, see WithReadChunk
+	readBufs    sync.Pool // of *[]byte, temporary slices of ReadFromSize
+	tee         io.Writer
+	alloc       func(size int) []byte // see WithAllocator
+
+	m      sync.RWMutex
+	nolock bool       // skip locking, see WithoutLocking
+	cond   *sync.Cond // signaled on changes of data and Close, created on first wait
+	closed bool
+
+	// available() and capacity stored on unlock, so Available and Size
+	// don't need the lock
+	length atomic.Int64
+	size   atomic.Int64
+
+	sm      sync.Mutex // guards scratch and wipes, never held with m
+	scratch []byte     // a snapshot of data used by WriteTo, see getScratch
+	wipes   uint64     // number of clearScratch calls
+}
+
+// NewByteRing creates a new ByteRing of a given size configured with opts.
+// A ByteRing of size 0 is valid but never holds data, all written bytes are
+// dropped and it's never full.
+func NewByteRing(size int, opts ...Option) *ByteRing {
+	return newByteRing(nil, size, opts)
+}
+
+// NewByteRingFromSlice creates a new empty ByteRing which uses buf as its
+// underlying slice, its size is len(buf). The ByteRing takes ownership of buf,
+// the caller must not use buf after this call. Memory beyond len(buf), up to
+// cap(buf), is never used. To keep the contents of buf as unread data, use
+// WithContents.
+func NewByteRingFromSlice(buf []byte, opts ...Option) *ByteRing {
+	return newByteRing(buf[:len(buf):len(buf)], len(buf), opts)
 }
 
-// NewByteRing creates a new ByteRing of a given size.
-func NewByteRing(size int) *ByteRing {
-	return &ByteRing{
-		b:    make([]byte, size),
-		end:  0, // points to the last element+1 wraped by size
-		full: false,
+// newByteRing creates a ByteRing of a given size which uses buf, or a slice
+// from makeSlice if buf is nil.
+func newByteRing(buf []byte, size int, opts []Option) *ByteRing {
+	b := &ByteRing{
+		b:        buf,
+		start:    0,
+		end:      0,
+		full:     false,
 		capacity: size,
-		m: sync.RWMutex{},
+		m:        sync.RWMutex{},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if buf == nil {
+		b.b = b.makeSlice(size)
+	}
+	b.publish()
+	return b
+}
+
+// makeSlice returns a new underlying slice of a given size, see
+// WithAllocator.
+func (b *ByteRing) makeSlice(size int) []byte {
+	if b.alloc == nil {
+		return make([]byte, size)
+	}
+	return b.alloc(size)[:size:size]
+}
+
+// NewByteRingUnsafe creates a new ByteRing of a given size which doesn't use
+// any locking. It's the same as NewByteRing(size, WithoutLocking()).
+func NewByteRingUnsafe(size int) *ByteRing {
+	return NewByteRing(size, WithoutLocking())
+}
+
+func (b *ByteRing) lock() {
+	if !b.nolock {
+		b.m.Lock()
+	}
+}
+
+func (b *ByteRing) unlock() {
+	if !b.nolock {
+		b.publish()
+		b.m.Unlock()
+	}
+}
+
+// publish stores values read by Available and Size without locking. It must
+// be called with the lock held after changing the state.
+func (b *ByteRing) publish() {
+	b.length.Store(int64(b.available()))
+	b.size.Store(int64(b.capacity))
+}
+
+func (b *ByteRing) rlock() {
+	if !b.nolock {
+		b.m.RLock()
+	}
+}
+
+func (b *ByteRing) runlock() {
+	if !b.nolock {
+		b.m.RUnlock()
 	}
 }
 
 func (b *ByteRing) available() int {
-	if !b.full {
-		return b.end
+	if b.full {
+		return b.capacity
+	}
+	if b.start <= b.end {
+		return b.end - b.start
 	}
-	return b.capacity
+	return b.capacity - b.start + b.end
 }
 
-// Available returns a number of bytes currently held in buffer.
-// After Size() bytes has been written it's equal to Size().
+// Available returns a number of unread bytes currently held in buffer.
+// After Size() bytes has been written without reading it's equal to Size().
+// It doesn't wait for the lock, it returns the value from the end of the last
+// completed operation.
 func (b *ByteRing) Available() int {
-	b.m.RLock()
-	defer b.m.RUnlock()
-	return b.available()
+	if b.nolock {
+		return b.available()
+	}
+	return int(b.length.Load())
+}
+
+// Stats returns the total number of bytes written into buffer and the number
+// of bytes dropped, either overwritten before being read or not stored at all
+// because they didn't fit. Both counters are cleared by Reset.
+func (b *ByteRing) Stats() (written, dropped uint64) {
+	b.rlock()
+	defer b.runlock()
+	return b.written, b.dropped
+}
+
+// Generation returns a number which changes every time a write drops unread
+// data, buffer is reset or restored by Restore. Offsets of unread data
+// obtained before are still valid, minus bytes consumed by reads, as long as
+// Generation() stays the same. Unlike Stats it's not cleared by Reset.
+func (b *ByteRing) Generation() uint64 {
+	b.rlock()
+	defer b.runlock()
+	return b.gen
 }
 
-// Size returns a size of buffer.
+// Remaining returns a number of bytes which can be written without
+// overwriting unread data, it's equal to Size() - Available(). In lossless
+// mode it's the most a single write accepts. In the default mode writes never
+// fail, bigger writes overwrite the oldest data.
+func (b *ByteRing) Remaining() int {
+	b.rlock()
+	defer b.runlock()
+	return b.capacity - b.available()
+}
+
+// IsFull reports whether buffer holds Size() unread bytes, next write will
+// overwrite the oldest data.
+func (b *ByteRing) IsFull() bool {
+	b.rlock()
+	defer b.runlock()
+	return b.full
+}
+
+// IsEmpty reports whether buffer has no unread data.
+func (b *ByteRing) IsEmpty() bool {
+	b.rlock()
+	defer b.runlock()
+	return b.available() == 0
+}
+
+// Size returns a size of buffer. Like Available it doesn't wait for the lock.
 func (b *ByteRing) Size() int {
-	return b.capacity
+	if b.nolock {
+		return b.capacity
+	}
+	return int(b.size.Load())
 }
 
-// Write writes a byte slice into buffer.
+// Len returns a number of unread bytes, it's the same as Available() and
+// matches bytes.Buffer.Len.
+func (b *ByteRing) Len() int {
+	return b.Available()
+}
+
+// Cap returns a size of buffer, it's the same as Size() and matches
+// bytes.Buffer.Cap.
+func (b *ByteRing) Cap() int {
+	return b.Size()
+}
+
+// Write writes a byte slice into buffer. Only the last Size() bytes of d are
+// retained, older data is overwritten. Bytes which do not fit are considered
+// accepted and dropped, so Write returns len(d) and nil error, except:
+//
+//   - a closed ByteRing writes nothing and returns ErrClosed,
+//   - if the ByteRing was created with WithLossless, Write never overwrites
+//     unread data. It writes only as many bytes as fit and returns
+//     io.ErrShortWrite if that's fewer than len(d),
+//   - an error of the tee writer set WithTee is returned, but data is stored
+//     nevertheless.
 func (b *ByteRing) Write(d []byte) (int, error) {
-	// we can only fit last b.size bytes
+	return put(b, d)
+}
+
+// WriteString writes a string into buffer, it works like Write but avoids
+// converting s into a byte slice.
+func (b *ByteRing) WriteString(s string) (int, error) {
+	return put(b, s)
+}
+
+// put writes d holding the lock, the overflow function is called after the
+// lock is released.
+func put[T []byte | string](b *ByteRing, d T) (int, error) {
+	b.lock()
+	if b.closed {
+		b.unlock()
+		return 0, ErrClosed
+	}
+	b.autoGrow(len(d))
+	var err error
+	if free := b.capacity - b.available(); b.lossless && len(d) > free {
+		d = d[:free]
+		err = io.ErrShortWrite
+	}
+	notify := evict(b, d)
+	n := write(b, d)
+	if terr := tee(b, d); err == nil {
+		err = terr
+	}
+	b.unlockReport()
+	if notify != nil {
+		notify()
+	}
+	return n, err
+}
+
+// WriteVec writes slices into buffer as if they were concatenated, under a
+// single lock and without joining them. It works like Write of the
+// concatenation, the returned count is of all slices together.
+func (b *ByteRing) WriteVec(slices ...[]byte) (int, error) {
+	n := 0
+	for _, d := range slices {
+		n += len(d)
+	}
+	b.lock()
+	if b.closed {
+		b.unlock()
+		return 0, ErrClosed
+	}
+	b.autoGrow(n)
+	var err error
+	if free := b.capacity - b.available(); b.lossless && n > free {
+		n = free
+		err = io.ErrShortWrite
+	}
+	notify := evictVec(b, slices, n)
+	b.writeVec(slices, n)
+	left := n
+	for _, d := range slices {
+		if left == 0 {
+			break
+		}
+		d = d[:min(len(d), left)]
+		left -= len(d)
+		if terr := tee(b, d); terr != nil {
+			if err == nil {
+				err = terr
+			}
+			break
+		}
+	}
+	b.unlockReport()
+	if notify != nil {
+		notify()
+	}
+	return n, err
+}
+
+// tee writes d into the tee writer, if any. It's called holding the lock, so
+// the tee writer receives data in the same order as buffer.
+func tee[T []byte | string](b *ByteRing, d T) error {
+	if b.tee == nil || len(d) == 0 {
+		return nil
+	}
+	var err error
+	switch d := any(d).(type) {
+	case []byte:
+		_, err = b.tee.Write(d)
+	case string:
+		_, err = io.WriteString(b.tee, d)
+	}
+	return err
+}
+
+// teeRepeat works like tee for n bytes equal to c.
+func teeRepeat(b *ByteRing, c byte, n int) error {
+	if b.tee == nil {
+		return nil
+	}
+	var chunk [64]byte
+	fill(chunk[:min(n, len(chunk))], c)
+	for n > 0 {
+		k, err := b.tee.Write(chunk[:min(n, len(chunk))])
+		if err != nil {
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
+
+// evictVec works like evict for the first n bytes of concatenated vec.
+func evictVec(b *ByteRing, vec [][]byte, n int) func() {
+	fn := b.onOverflow
+	k := n - (b.capacity - b.available())
+	if fn == nil || k <= 0 {
+		return nil
+	}
+	dropped := make([]byte, k)
+	m := b.copyAt(dropped, 0)
+	for _, d := range vec {
+		m += copy(dropped[m:], d)
+	}
+	return func() { fn(dropped) }
+}
+
+// writeVec works like write of the first n bytes of concatenated vec.
+func (b *ByteRing) writeVec(vec [][]byte, n int) {
+	if n == 0 {
+		return
+	}
+	skip := max(n-b.capacity, 0) // leading bytes which don't fit
+	left := n - skip
+	at := b.end
+	if n >= b.capacity {
+		at = 0
+	}
+	for _, d := range vec {
+		if left == 0 {
+			break
+		}
+		if skip >= len(d) {
+			skip -= len(d)
+			continue
+		}
+		d = d[skip:min(len(d), skip+left)]
+		skip = 0
+		// left never exceeds the size, so d can wrap only once
+		copy(b.b, d[copy(b.b[at:], d):])
+		at = (at + len(d)) % b.capacity
+		left -= len(d)
+	}
+	b.advance(n)
+}
+
+// Writer returns an io.Writer writing into buffer, which can be given to
+// several producers at once. Each Write is atomic, data of concurrent writes
+// is never interleaved, but their order is unspecified. The writer doesn't
+// implement io.ReaderFrom: io.Copy into the ByteRing itself uses ReadFrom,
+// which holds the lock until the source is exhausted, while io.Copy into the
+// writer takes the lock once per copied chunk.
+func (b *ByteRing) Writer() io.Writer {
+	return writer{b}
+}
+
+// writer hides all methods of ByteRing except Write.
+type writer struct {
+	b *ByteRing
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	return w.b.Write(p)
+}
+
+// TryWrite writes as many bytes of p as fit without overwriting unread data,
+// in any mode. It returns the number of bytes written and whether all of p
+// was written. Nothing is written into a closed ByteRing. Errors of the tee
+// writer set WithTee are not reported.
+func (b *ByteRing) TryWrite(p []byte) (int, bool) {
+	b.lock()
+	if b.closed {
+		b.unlock()
+		return 0, len(p) == 0
+	}
+	b.autoGrow(len(p))
+	n := write(b, p[:min(len(p), b.capacity-b.available())])
+	tee(b, p[:n])
+	b.unlockReport()
+	return n, n == len(p)
+}
+
+// OnOverflow sets a function called with a copy of bytes dropped by a write,
+// oldest first. Those are unread bytes which got overwritten followed by the
+// beginning of written data which didn't fit into buffer. The function is
+// called after the write completes without holding the lock, so it may use
+// the ByteRing. Passing nil removes the function.
+func (b *ByteRing) OnOverflow(fn func(dropped []byte)) {
+	b.lock()
+	defer b.unlock()
+	b.onOverflow = fn
+}
+
+// OnFull sets a function called when a write makes buffer full for the first
+// time, so next writes will overwrite data. After Reset it's called again on
+// the next fill. Like OnOverflow, it's called without holding the lock.
+// Passing nil removes the function.
+func (b *ByteRing) OnFull(fn func()) {
+	b.lock()
+	defer b.unlock()
+	b.onFull = fn
+}
+
+// evict returns a function passing bytes which writing d is going to drop
+// into the overflow function, or nil if there is nothing to report.
+func evict[T []byte | string](b *ByteRing, d T) func() {
+	fn := b.onOverflow
+	k := len(d) - (b.capacity - b.available())
+	if fn == nil || k <= 0 {
+		return nil
+	}
+	dropped := make([]byte, k)
+	n := b.copyAt(dropped, 0)
+	copy(dropped[n:], d)
+	return func() { fn(dropped) }
+}
+
+// Observer receives events about data written into a ByteRing, e.g. to
+// export metrics. It's set with WithObserver. Methods are called after a
+// write completes, without holding the lock, events of a single write may be
+// merged into one call.
+type Observer interface {
+	// BytesWritten reports n bytes written, the same as counted by Stats.
+	BytesWritten(n int)
+	// BytesDropped reports n bytes dropped, the same as counted by Stats.
+	BytesDropped(n int)
+	// Wrapped reports that writing reached the end of the underlying slice
+	// and continues from its beginning.
+	Wrapped()
+}
+
+// observed holds events not yet passed to Observer.
+type observed struct {
+	written, dropped, wraps int
+}
+
+func write[T []byte | string](b *ByteRing, d T) int {
+	// we can only fit last b.capacity bytes
 	ld := len(d)
-	b.m.Lock()
-	defer b.m.Unlock()
 	if ld >= b.capacity {
 		copy(b.b, d[ld-b.capacity:])
-		b.end = 0
+	} else {
+		n := copy(b.b[b.end:], d)
+		copy(b.b, d[n:])
+	}
+	b.advance(ld)
+	return ld
+}
+
+// WriteByte writes a single byte into buffer, overwriting the oldest byte if
+// buffer is full. It returns io.ErrShortWrite for a zero size buffer or if
+// buffer is full and the ByteRing was created with WithLossless.
+func (b *ByteRing) WriteByte(c byte) error {
+	b.lock()
+	if b.closed {
+		b.unlock()
+		return ErrClosed
+	}
+	b.autoGrow(1)
+	if b.lossless && b.full {
+		b.unlock()
+		return io.ErrShortWrite
+	}
+	notify := evict(b, []byte{c})
+	err := b.writeByte(c)
+	if b.tee != nil {
+		if terr := tee(b, []byte{c}); err == nil {
+			err = terr
+		}
+	}
+	b.unlockReport()
+	if notify != nil {
+		notify()
+	}
+	return err
+}
+
+func (b *ByteRing) writeByte(c byte) error {
+	b.signal()
+	if b.capacity == 0 {
+		b.count(1, 1, false)
+		return io.ErrShortWrite
+	}
+	dropped := 0
+	if b.full {
+		dropped = 1
+	}
+	b.count(1, dropped, b.end+1 == b.capacity)
+	b.b[b.end] = c
+	b.indexLines(1)
+	b.end = (b.end + 1) % b.capacity
+	if b.full { // oldest unread byte got overwritten
+		b.start = b.end
+	} else if b.end == b.start {
 		b.full = true
-		return ld, nil
 	}
+	b.behind = min(b.behind, b.capacity-b.available())
+	return nil
+}
 
-	firstIdx := b.end
-	beforeRewind := b.capacity - firstIdx
-	if beforeRewind >= ld { // can fit into first interval
-		n := copy(b.b[firstIdx:], d)
-		b.end = (b.end + n) % b.capacity
-		return n, nil
+// advance marks n bytes, already placed in the underlying slice after end, as
+// written. If n >= Size(), the last Size() bytes are expected at the
+// beginning of the slice.
+func (b *ByteRing) advance(n int) {
+	if n == 0 {
+		return
 	}
-	n := copy(b.b[firstIdx:], d[:beforeRewind])
-	n += copy(b.b, d[beforeRewind:])
-	b.full = true // we wrap, means we are full
+	free := b.capacity - b.available()
+	b.count(n, max(n-free, 0), b.capacity > 0 && b.end+n >= b.capacity)
+	b.indexLines(n)
+	b.signal()
+	if n >= b.capacity {
+		b.start = 0
+		b.end = 0
+		b.full = b.capacity > 0
+		b.behind = 0
+		return
+	}
+
 	b.end = (b.end + n) % b.capacity
-	return n, nil
+	if n >= free { // unread data got overwritten, oldest now starts at end
+		b.start = b.end
+		b.full = true
+	}
+	b.behind = min(b.behind, b.capacity-b.available())
+}
+
+// count updates write statistics and events pending for the observer.
+func (b *ByteRing) count(written, dropped int, wrapped bool) {
+	b.written += uint64(written)
+	b.dropped += uint64(dropped)
+	if dropped > 0 {
+		b.gen++
+	}
+	if b.observer == nil {
+		return
+	}
+	b.pending.written += written
+	b.pending.dropped += dropped
+	if wrapped {
+		b.pending.wraps++
+	}
+}
+
+// unlockReport unlocks buffer and then passes pending events to the
+// observer, so it's called without holding the lock.
+func (b *ByteRing) unlockReport() {
+	obs, p := b.observer, b.pending
+	b.pending = observed{}
+	var onFull func()
+	if b.full && !b.fullFired {
+		onFull = b.onFull
+		b.fullFired = onFull != nil
+	}
+	b.unlock()
+	if onFull != nil {
+		onFull()
+	}
+	if obs == nil {
+		return
+	}
+	if p.written > 0 {
+		obs.BytesWritten(p.written)
+	}
+	if p.dropped > 0 {
+		obs.BytesDropped(p.dropped)
+	}
+	for range p.wraps {
+		obs.Wrapped()
+	}
+}
+
+// WriteRepeat writes n copies of c into buffer without allocating them. It
+// works like Write of such a slice.
+func (b *ByteRing) WriteRepeat(c byte, n int) (int, error) {
+	if n <= 0 {
+		return 0, nil
+	}
+	b.lock()
+	if b.closed {
+		b.unlock()
+		return 0, ErrClosed
+	}
+	b.autoGrow(n)
+	var err error
+	free := b.capacity - b.available()
+	if b.lossless && n > free {
+		n = free
+		err = io.ErrShortWrite
+	}
+	var dropped []byte
+	fn := b.onOverflow
+	if fn != nil && n > free {
+		dropped = make([]byte, n-free)
+		fill(dropped[b.copyAt(dropped, 0):], c)
+	}
+	if n >= b.capacity {
+		fill(b.b, c)
+	} else {
+		fill(b.b[b.end:min(b.end+n, b.capacity)], c)
+		fill(b.b[:max(b.end+n-b.capacity, 0)], c)
+	}
+	b.advance(n)
+	if terr := teeRepeat(b, c, n); err == nil {
+		err = terr
+	}
+	b.unlockReport()
+	if dropped != nil {
+		fn(dropped)
+	}
+	return n, err
+}
+
+// fill sets all bytes of d to c.
+func fill(d []byte, c byte) {
+	for i := range d {
+		d[i] = c
+	}
+}
+
+// Read reads up to len(p) of the oldest unread bytes into p and removes them
+// from buffer. If buffer has no data to return, err is io.EOF (unless len(p)
+// is zero).
+func (b *ByteRing) Read(p []byte) (int, error) {
+	b.lock()
+	defer b.unlock()
+	return b.read(p)
+}
+
+// BlockingRead works like Read but if buffer is empty it waits until some
+// data is written or the ByteRing is closed. After Close it returns
+// remaining data and then io.EOF. Without locking it never waits.
+func (b *ByteRing) BlockingRead(p []byte) (int, error) {
+	b.lock()
+	defer b.unlock()
+	for len(p) > 0 && b.available() == 0 && !b.closed && !b.nolock {
+		b.wait()
+	}
+	return b.read(p)
+}
+
+// ReadContext works like BlockingRead but stops waiting when ctx is done,
+// then it returns ctx.Err(). Available data is returned even if ctx is
+// already done.
+func (b *ByteRing) ReadContext(ctx context.Context, p []byte) (int, error) {
+	b.lock()
+	defer b.unlock()
+	if len(p) > 0 && b.available() == 0 && !b.closed && !b.nolock {
+		stop := context.AfterFunc(ctx, b.wake)
+		defer stop()
+		for b.available() == 0 && !b.closed {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			b.wait()
+		}
+	}
+	return b.read(p)
+}
+
+// WriteContext works like Write, but if the ByteRing was created with
+// WithLossless, instead of returning io.ErrShortWrite it waits for reads to
+// free space until all of p is written or ctx is done, then it returns
+// ctx.Err(). Without locking it never waits.
+func (b *ByteRing) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if !b.lossless || b.nolock {
+		return b.Write(p)
+	}
+	n := 0
+	for {
+		m, err := b.Write(p[n:])
+		n += m
+		if err != io.ErrShortWrite {
+			return n, err
+		}
+		if err := b.waitFree(ctx); err != nil {
+			return n, err
+		}
+	}
+}
+
+// waitFree waits until buffer has free space, it's closed or ctx is done. A
+// zero size buffer never has free space, it returns io.ErrShortWrite.
+func (b *ByteRing) waitFree(ctx context.Context) error {
+	b.lock()
+	defer b.unlock()
+	if b.capacity == 0 {
+		return io.ErrShortWrite
+	}
+	stop := context.AfterFunc(ctx, b.wake)
+	defer stop()
+	for b.available() == b.capacity && !b.closed {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b.wait()
+	}
+	return nil
+}
+
+// Close closes the ByteRing and wakes up all goroutines waiting in
+// BlockingRead. Unread data can be still read, but all writes fail with
+// ErrClosed. Closing an already closed ByteRing does nothing.
+func (b *ByteRing) Close() error {
+	b.lock()
+	defer b.unlock()
+	b.closed = true
+	b.signal()
+	return nil
+}
+
+// wait waits for a change of data, the lock must be held.
+func (b *ByteRing) wait() {
+	if b.cond == nil {
+		b.cond = sync.NewCond(&b.m)
+	}
+	b.cond.Wait()
+}
+
+// wake works like signal but takes the lock.
+func (b *ByteRing) wake() {
+	b.lock()
+	defer b.unlock()
+	b.signal()
+}
+
+// signal wakes up all goroutines waiting for a change of data, the lock must
+// be held.
+func (b *ByteRing) signal() {
+	if b.cond != nil {
+		b.cond.Broadcast()
+	}
+}
+
+func (b *ByteRing) read(p []byte) (int, error) {
+	if b.available() == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return b.dequeue(p), nil
 }
 
-// Reset resets the state of ByteRing to empty.
+// Dequeue copies the oldest len(dest) bytes into dest and removes them from
+// buffer. It returns the number of bytes copied, if buffer contains fewer
+// than len(dest) bytes, it's drained.
+func (b *ByteRing) Dequeue(dest []byte) int {
+	b.lock()
+	defer b.unlock()
+	return b.dequeue(dest)
+}
+
+// Drain works like Dequeue but also returns the number of unread bytes left
+// after the call, taken under the same lock. It's meant for emptying buffer
+// in a loop, which with concurrent writers stops at a consistent point
+// rather than racing a separate Available call:
+//
+//	for {
+//		n, rest := buf.Drain(chunk)
+//		process(chunk[:n])
+//		if rest == 0 {
+//			break
+//		}
+//	}
+func (b *ByteRing) Drain(dest []byte) (n, remaining int) {
+	b.lock()
+	defer b.unlock()
+	n = b.dequeue(dest)
+	return n, b.available()
+}
+
+func (b *ByteRing) dequeue(dest []byte) int {
+	n := b.copyAt(dest, 0)
+	b.discard(n)
+	b.behind += n
+	return n
+}
+
+// ReadByte reads and returns the oldest unread byte. If no byte is available,
+// returns error io.EOF.
+func (b *ByteRing) ReadByte() (byte, error) {
+	b.lock()
+	defer b.unlock()
+	if b.available() == 0 {
+		return 0, io.EOF
+	}
+	c := b.b[b.start]
+	b.discard(1)
+	b.behind++
+	return c, nil
+}
+
+// UnreadByte unreads the last byte read. It returns ErrInvalidUnreadByte if
+// nothing has been read yet or the byte has been overwritten since.
+func (b *ByteRing) UnreadByte() error {
+	b.lock()
+	defer b.unlock()
+	if b.behind == 0 {
+		return ErrInvalidUnreadByte
+	}
+	b.behind--
+	b.start = (b.start + b.capacity - 1) % b.capacity
+	b.full = b.start == b.end
+	return nil
+}
+
+// ReadPos returns the position of the read cursor, which is the number of
+// already read bytes still held in buffer. Those bytes can be read again
+// after SeekRead.
+func (b *ByteRing) ReadPos() int {
+	b.rlock()
+	defer b.runlock()
+	return b.behind
+}
+
+// SeekRead moves the read cursor to offset, where offset 0 means the oldest
+// byte held in buffer, read or not. Moving it back makes already read bytes
+// unread again, moving it forward works like Discard. It returns an error if
+// offset is negative or beyond the newest byte.
+func (b *ByteRing) SeekRead(offset int) error {
+	b.lock()
+	defer b.unlock()
+	if offset < 0 || offset > b.behind+b.available() {
+		return errOutOfRange
+	}
+	if n := offset - b.behind; n >= 0 {
+		b.discard(n)
+	} else {
+		b.start = (b.start + b.capacity + n) % b.capacity
+		b.full = b.start == b.end
+		b.signal()
+	}
+	b.behind = offset
+	return nil
+}
+
+// Discard skips the next n unread bytes and returns the number of bytes
+// discarded. If buffer contains fewer than n bytes, all of them are discarded.
+func (b *ByteRing) Discard(n int) int {
+	b.lock()
+	defer b.unlock()
+	n = max(min(n, b.available()), 0)
+	b.discard(n)
+	b.behind += n
+	return n
+}
+
+// Truncate discards all but the newest n unread bytes. It doesn't change the
+// size of buffer, see Resize for that.
+func (b *ByteRing) Truncate(n int) {
+	b.lock()
+	defer b.unlock()
+	k := b.available() - max(n, 0)
+	if k <= 0 {
+		return
+	}
+	b.discard(k)
+	b.behind += k
+}
+
+// discard drops n oldest bytes, n must not exceed available().
+func (b *ByteRing) discard(n int) {
+	if n == 0 {
+		return
+	}
+	b.start = (b.start + n) % b.capacity
+	b.full = false
+	b.signal() // wake up writers waiting for free space
+}
+
+// pos maps a logical offset of unread data to an index of the underlying
+// slice.
+func (b *ByteRing) pos(offset int) int {
+	i := b.start + offset
+	if i >= b.capacity {
+		i -= b.capacity
+	}
+	return i
+}
+
+// copyAt copies unread bytes starting at a logical offset into dest.
+func (b *ByteRing) copyAt(dest []byte, offset int) int {
+	availableData := b.available() - offset
+	if offset < 0 || availableData <= 0 {
+		return 0
+	}
+	if len(dest) > availableData {
+		dest = dest[:availableData]
+	}
+	// dest is already limited to unread data, so it's safe to copy until the
+	// end of slice and continue from its beginning.
+	n := copy(dest, b.b[b.pos(offset):])
+	return n + copy(dest[n:], b.b)
+}
+
+// Reset resets the state of ByteRing to empty. If the ByteRing was created
+// with WithZeroOnReset, it also works like ResetZero. The underlying slice is
+// kept, so a ByteRing can be recycled, e.g. with sync.Pool:
+//
+//	buf := pool.Get().(*bytering.ByteRing)
+//	defer func() {
+//		buf.Reset()
+//		pool.Put(buf)
+//	}()
 func (b *ByteRing) Reset() {
-	b.m.Lock()
-	defer b.m.Unlock()
+	b.lock()
+	defer b.unlock()
+	if b.zeroOnReset {
+		clear(b.b)
+	}
+	b.reset()
+}
+
+// ResetAndResize works like Reset but also changes the size of buffer to
+// size. The underlying slice is reused if its capacity is at least size,
+// otherwise a new one is allocated.
+func (b *ByteRing) ResetAndResize(size int) error {
+	if size < 0 {
+		return errNegativeSize
+	}
+	b.lock()
+	defer b.unlock()
+	if size <= cap(b.b) {
+		if b.zeroOnReset {
+			clear(b.b[:cap(b.b)])
+		}
+		b.b = b.b[:size]
+	} else {
+		b.b = b.makeSlice(size)
+	}
+	b.capacity = size
+	b.reset()
+	return nil
+}
+
+func (b *ByteRing) reset() {
+	b.signal()
+	b.fullFired = false
+	b.epoch++
+	b.lines.valid = false
+	b.gen++
+	b.start = 0
+	b.end = 0
+	b.full = false
+	b.behind = 0
+	b.written = 0
+	b.dropped = 0
+}
+
+// ResetZero works like Reset but also overwrites the whole underlying slice
+// with zeros, so no data is left in memory. Unlike Reset, which is O(1), its
+// cost is proportional to Size().
+func (b *ByteRing) ResetZero() {
+	b.clearScratch()
+	b.lock()
+	defer b.unlock()
+	clear(b.b)
+	b.reset()
+}
+
+// Fill sets every byte of buffer to c and makes it full. All previous data
+// is replaced, it's counted as written Size() bytes and unread data is
+// passed to the overflow function as dropped. In lossless mode unread data
+// is kept and only the free space is filled. Fill does nothing if the
+// ByteRing is closed.
+func (b *ByteRing) Fill(c byte) {
+	b.lock()
+	if b.closed {
+		b.unlock()
+		return
+	}
+	if b.lossless {
+		n := b.capacity - b.available()
+		fill(b.b[b.end:min(b.end+n, b.capacity)], c)
+		fill(b.b[:max(b.end+n-b.capacity, 0)], c)
+		b.advance(n)
+		teeRepeat(b, c, n)
+		b.unlockReport()
+		return
+	}
+	fn := b.onOverflow
+	var dropped []byte
+	if fn != nil && b.available() > 0 {
+		dropped = make([]byte, b.available())
+		b.copyAt(dropped, 0)
+	}
+	b.epoch++
+	b.lines.valid = false
+	b.count(b.capacity, b.available(), false)
+	fill(b.b, c)
+	teeRepeat(b, c, b.capacity)
+	b.start = 0
 	b.end = 0
+	b.full = b.capacity > 0
+	b.behind = 0
+	b.signal()
+	b.unlockReport()
+	if dropped != nil {
+		fn(dropped)
+	}
+}
+
+// Clone returns an independent copy of buffer with the same size, contents,
+// options and state, including Stats and whether it's closed. The copy
+// doesn't share memory with the original, its underlying slice is obtained
+// from the allocator set WithAllocator, if any. The functions set by
+// OnOverflow and OnFull are not copied, nor are bytes returned by PeekN, so
+// they can be committed only in the original.
+func (b *ByteRing) Clone() *ByteRing {
+	b.rlock()
+	defer b.runlock()
+	c := NewByteRing(b.capacity, WithAllocator(b.alloc))
+	copy(c.b, b.b)
+	c.zeroOnReset = b.zeroOnReset
+	c.lossless = b.lossless
+	c.maxGrow = b.maxGrow
+	c.observer = b.observer
+	c.tee = b.tee
+	c.readChunk = b.readChunk
+	c.lines.enabled = b.lines.enabled
+	c.start = b.start
+	c.end = b.end
+	c.full = b.full
+	c.behind = b.behind
+	c.nolock = b.nolock
+	c.closed = b.closed
+	c.written = b.written
+	c.dropped = b.dropped
+	c.epoch = b.epoch
+	c.gen = b.gen
+	c.fullFired = b.fullFired
+	c.publish()
+	return c
+}
+
+// Resize changes the size of buffer to newSize. It allocates a new slice and
+// keeps the newest min(Available(), newSize) unread bytes.
+func (b *ByteRing) Resize(newSize int) error {
+	if newSize < 0 {
+		return errNegativeSize
+	}
+	b.lock()
+	defer b.unlockReport()
+	b.resize(newSize)
+	return nil
+}
+
+// Grow grows buffer, if necessary, so it can hold at least n bytes. The size
+// is at least doubled to amortize consecutive calls. All data is preserved.
+func (b *ByteRing) Grow(n int) {
+	b.lock()
+	defer b.unlockReport()
+	if n <= b.capacity {
+		return
+	}
+	b.resize(max(n, 2*b.capacity))
+}
+
+// Compact rotates the underlying slice in place so the oldest unread byte is
+// at index 0. Unread data doesn't change. It does nothing if data already
+// starts at index 0.
+func (b *ByteRing) Compact() {
+	b.lock()
+	defer b.unlock()
+	if b.start == 0 {
+		return
+	}
+	b.epoch++
+	b.lines.valid = false
+	slices.Reverse(b.b[:b.start])
+	slices.Reverse(b.b[b.start:])
+	slices.Reverse(b.b)
+	b.end = (b.end - b.start + b.capacity) % b.capacity
+	b.start = 0
+}
+
+// autoGrow grows buffer, if it was created WithAutoGrow, so n more bytes fit
+// without overwriting unread data. The size is doubled, but not beyond the
+// limit.
+func (b *ByteRing) autoGrow(n int) {
+	need := b.available() + n
+	if need <= b.capacity || b.capacity >= b.maxGrow {
+		return
+	}
+	size := max(b.capacity, 1)
+	for size < need && size < b.maxGrow {
+		size *= 2
+	}
+	b.resize(min(size, b.maxGrow))
+}
+
+func (b *ByteRing) resize(newSize int) {
+	b.epoch++
+	b.lines.valid = false
+	available := b.available()
+	n := min(available, newSize)
+	b.count(0, available-n, false)
+	d := b.makeSlice(newSize)
+	b.copyAt(d, available-n)
+	b.b = d
+	b.capacity = newSize
+	b.start = 0
+	b.end = n
 	b.full = false
+	b.behind = 0
+	if n == newSize {
+		b.end = 0
+		b.full = n > 0
+	}
+}
+
+// wrapped reports whether unread data is split into two intervals.
+func (b *ByteRing) wrapped() bool {
+	return b.full || b.end < b.start
 }
 
-func (b *ByteRing) firstInterval() (int, int) {
-	if !b.full {
-		return 0, b.end
+// intervals returns unread data as two slices of the underlying slice, the
+// second one is empty unless data is wrapped. It's valid in any state.
+func (b *ByteRing) intervals() ([]byte, []byte) {
+	if !b.wrapped() {
+		return b.b[b.start:b.end], nil
 	}
-	return b.end, b.capacity
+	return b.b[b.start:], b.b[:b.end]
 }
 
-func (b *ByteRing) secondInterval() (int, int) {
-	if !b.full {
-		panic("if not full, no second interval")
+// Intervals returns unread data without copying, as two slices of the
+// underlying slice, from the oldest to the newest. The second one is nil
+// unless data is wrapped. Buffer is read locked until release is called, so
+// writes wait for it. Until then the goroutine must not call back into the
+// ring's locking methods, even read only ones like Bytes: a recursive read
+// lock deadlocks once a writer is waiting. The slices must not be modified
+// nor used after calling release. Without locking they are valid only until
+// the next change of buffer.
+func (b *ByteRing) Intervals() (first, second []byte, release func()) {
+	b.rlock()
+	first, second = b.intervals()
+	if len(second) == 0 {
+		second = nil
 	}
-	return 0, b.end
+	return first, second, b.runlock
 }
 
-// WriteTo writes all data into provided writer.
-func (b *ByteRing) WriteTo(w io.Writer) (int, error) {
-	b.m.RLock()
-	defer b.m.RUnlock()
-	start, end := b.firstInterval()
-	n, err := w.Write(b.b[start:end])
-	if err != nil || !b.full {
-		return n, err
+// WriteTo writes all data into provided writer. Data is first copied into an
+// internal buffer, so w.Write is called without holding the lock and doesn't
+// block writers. The copy is taken under a single lock, so w receives a
+// point-in-time image even while concurrent writes continue. Concurrent
+// WriteTo calls don't wait for each other nor for w, neither do resets.
+// Without locking data is written directly from the underlying slice.
+//
+// Data may be passed in more than one Write call, but always in order, so a
+// streaming writer like hash.Hash receives exactly the bytes Bytes() returns.
+//
+// WriteTo implements io.WriterTo, so io.Copy from a ByteRing uses it. Note
+// that unlike Read it doesn't consume data.
+func (b *ByteRing) WriteTo(w io.Writer) (int64, error) {
+	if b.nolock {
+		return b.writeTo(w)
 	}
+	n, err := b.WriteToContiguous(w)
+	return int64(n), err
+}
 
-	n1 := 0
-	n1, err = w.Write(b.b[:start])
-	n += n1
+// Flush writes all unread data into w and removes it from buffer in a single
+// locked operation, so concurrent writes are neither flushed twice nor lost.
+// The lock is held during w.Write calls. If w fails, only the bytes it
+// accepted are removed.
+func (b *ByteRing) Flush(w io.Writer) (int, error) {
+	b.lock()
+	defer b.unlock()
+	first, second := b.intervals()
+	n, err := writeIntervals(w, first, second)
+	b.discard(n)
+	b.behind += n
 	return n, err
 }
 
-// ReadFrom reads from a provided reader until reaches io.EOF
-func (b *ByteRing) ReadFrom(r io.Reader) (int, error) {
-	buf := make([]byte, 256)
-	var err error
+// WriteToContiguous works like WriteTo but always passes all data in a single
+// w.Write call, also without locking. Data is copied into an internal buffer
+// which is reused by later calls.
+func (b *ByteRing) WriteToContiguous(w io.Writer) (int, error) {
+	d, wipes := b.getScratch()
+	b.rlock()
+	first, second := b.intervals()
+	d = append(append(d, first...), second...)
+	b.runlock()
+	defer b.putScratch(d, wipes)
+	return w.Write(d)
+}
+
+// getScratch takes the reusable slice for a snapshot of data, so w.Write can
+// be called without holding any lock. Concurrent callers get a nil slice.
+func (b *ByteRing) getScratch() ([]byte, uint64) {
+	b.sm.Lock()
+	defer b.sm.Unlock()
+	d := b.scratch[:0]
+	b.scratch = nil
+	return d, b.wipes
+}
+
+// putScratch returns the slice taken by getScratch. It's cleared first if
+// buffer was created WithZeroOnReset or ResetZero was called since, so no
+// copy of data outlives the write.
+func (b *ByteRing) putScratch(d []byte, wipes uint64) {
+	b.sm.Lock()
+	defer b.sm.Unlock()
+	if b.zeroOnReset || wipes != b.wipes {
+		clear(d)
+	}
+	if b.scratch == nil {
+		b.scratch = d[:0]
+	}
+}
+
+// clearScratch overwrites the reusable snapshot slice with zeros, also the
+// one currently used by WriteTo once it's returned.
+func (b *ByteRing) clearScratch() {
+	b.sm.Lock()
+	defer b.sm.Unlock()
+	clear(b.scratch[:cap(b.scratch)])
+	b.wipes++
+}
+
+// WriteToSnapshot is the same as WriteTo, the name states its guarantee: w
+// receives unread data as it was at a single point in time.
+func (b *ByteRing) WriteToSnapshot(w io.Writer) (int64, error) {
+	return b.WriteTo(w)
+}
+
+// BuffersWriter is implemented by writers which can write several slices in a
+// single call, e.g. using writev. Only WriteTo of a ByteRing created
+// WithoutLocking uses it, for wrapped data. With locking WriteTo always
+// copies data and passes it in a single w.Write call.
+type BuffersWriter interface {
+	WriteBuffers(bufs net.Buffers) (int64, error)
+}
+
+// writeTo writes data directly from the underlying slice. Wrapped data is
+// written with a single call if w is a BuffersWriter or a net.Conn, which
+// uses writev when possible.
+func (b *ByteRing) writeTo(w io.Writer) (int64, error) {
+	if b.wrapped() {
+		switch bw := w.(type) {
+		case BuffersWriter:
+			first, second := b.intervals()
+			return bw.WriteBuffers(net.Buffers{first, second})
+		case net.Conn:
+			first, second := b.intervals()
+			bufs := net.Buffers{first, second}
+			return bufs.WriteTo(bw)
+		}
+	}
+	first, second := b.intervals()
+	n, err := w.Write(first)
+	if err != nil || !b.wrapped() {
+		return int64(n), err
+	}
+	n1, err := w.Write(second)
+	return int64(n + n1), err
+}
+
+// WriteToRange writes n unread bytes starting at offset into w, where offset
+// 0 means the oldest unread byte. The range is clamped to Available(). Like
+// WriteTo it doesn't consume data and calls w.Write without holding the lock.
+func (b *ByteRing) WriteToRange(w io.Writer, offset, n int) (int, error) {
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	if n < 0 {
+		return 0, errNegativeSize
+	}
+	return b.writeRange(w, func() (int, int) { return offset, n })
+}
+
+// WriteToN writes the newest n unread bytes into w, or all of them if n is
+// larger than Available(). It works like WriteToRange.
+func (b *ByteRing) WriteToN(w io.Writer, n int) (int, error) {
+	if n < 0 {
+		return 0, errNegativeSize
+	}
+	return b.writeRange(w, func() (int, int) {
+		available := b.available()
+		return available - min(n, available), n
+	})
+}
+
+// writeRange writes a range of unread data returned by span into w. span is
+// called holding the lock.
+func (b *ByteRing) writeRange(w io.Writer, span func() (offset, n int)) (int, error) {
+	if b.nolock {
+		first, second := b.rangeIntervals(span())
+		return writeIntervals(w, first, second)
+	}
+	d, wipes := b.getScratch()
+	b.rlock()
+	first, second := b.rangeIntervals(span())
+	d = append(append(d, first...), second...)
+	b.runlock()
+	defer b.putScratch(d, wipes)
+	if len(d) == 0 {
+		return 0, nil
+	}
+	return w.Write(d)
+}
+
+// Reader returns a reader of n unread bytes starting at offset, where offset
+// 0 means the oldest unread byte. The range is clamped to Available(), a
+// negative offset or n gives an empty reader. The bytes are copied when
+// Reader is called, so later writes into buffer don't affect the reader.
+func (b *ByteRing) Reader(offset, n int) io.Reader {
+	if offset < 0 || n < 0 {
+		return bytes.NewReader(nil)
+	}
+	b.rlock()
+	defer b.runlock()
+	first, second := b.rangeIntervals(offset, n)
+	return bytes.NewReader(append(append([]byte(nil), first...), second...))
+}
+
+// rangeIntervals works like intervals but returns only n unread bytes
+// starting at offset, clamped to unread data.
+func (b *ByteRing) rangeIntervals(offset, n int) ([]byte, []byte) {
+	first, second := b.intervals()
+	if offset >= len(first) {
+		offset -= len(first)
+		first, second = second, nil
+		offset = min(offset, len(first))
+	}
+	first = first[offset:]
+	if n <= len(first) {
+		return first[:n], nil
+	}
+	return first, second[:min(n-len(first), len(second))]
+}
+
+// writeIntervals writes first and then second into w, skipping empty ones.
+func writeIntervals(w io.Writer, first, second []byte) (int, error) {
 	n := 0
-	for err != nil {
+	for _, d := range [][]byte{first, second} {
+		if len(d) == 0 {
+			continue
+		}
+		m, err := w.Write(d)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Limits of the default chunk size used by ReadFrom.
+const (
+	minReadFromChunk = 512
+	maxReadFromChunk = 32 * 1024
+)
+
+// ReadFrom reads from a provided reader until reaches io.EOF. The lock is
+// held until r returns an error, other goroutines can't access the ByteRing
+// in the meantime. Data is read in chunks of Size() bytes, but at least 512
+// and at most 32KiB, unless set by WithReadChunk.
+//
+// ReadFrom implements io.ReaderFrom, so io.Copy into a ByteRing uses it.
+func (b *ByteRing) ReadFrom(r io.Reader) (int64, error) {
+	return b.ReadFromSize(r, 0)
+}
+
+// ReadFromSize works like ReadFrom but reads data in chunks of a given size.
+// If chunk is not positive, the ReadFrom default is used.
+//
+// While buffer has free space, data is read directly into the underlying
+// slice. Once it's full, chunks are read into a temporary slice, so r can't
+// damage unread data. Temporary slices are pooled, so repeated calls don't
+// allocate. If the ByteRing was created with WithLossless, reading
+// stops with io.ErrShortWrite once buffer is full, even if r has no more data
+// but hasn't reported io.EOF yet.
+func (b *ByteRing) ReadFromSize(r io.Reader, chunk int) (int64, error) {
+	b.lock()
+	defer b.unlockReport()
+	if chunk <= 0 {
+		chunk = b.readChunk
+	}
+	if chunk <= 0 {
+		chunk = min(max(b.capacity, minReadFromChunk), maxReadFromChunk)
+	}
+	var buf []byte
+	var pooled *[]byte
+	defer func() {
+		if pooled != nil {
+			b.readBufs.Put(pooled)
+		}
+	}()
+	var err error
+	var n int64
+	for err == nil {
+		if b.closed {
+			return n, ErrClosed
+		}
 		n1 := 0
+		if b.available() == b.capacity {
+			b.autoGrow(chunk)
+		}
+		if free := b.capacity - b.available(); free > 0 {
+			p := b.b[b.end : b.end+min(free, b.capacity-b.end, chunk)]
+			// r may use the whole p, bytes kept for UnreadByte are lost
+			b.behind = min(b.behind, free-len(p))
+			n1, err = r.Read(p)
+			b.advance(n1)
+			n += int64(n1)
+			if terr := tee(b, p[:n1]); err == nil {
+				err = terr
+			}
+			continue
+		}
+		if b.lossless {
+			return n, io.ErrShortWrite
+		}
+		if buf == nil {
+			pooled, buf = b.readBuf(chunk)
+		}
 		n1, err = r.Read(buf)
-		b.Write(buf[:n1])
-		n += n1
+		notify := evict(b, buf[:n1])
+		write(b, buf[:n1])
+		n += int64(n1)
+		if terr := tee(b, buf[:n1]); err == nil {
+			err = terr
+		}
+		if notify != nil {
+			// don't call the overflow function with the lock held
+			b.unlockReport()
+			notify()
+			b.lock()
+		}
 	}
 	if err == io.EOF {
 		err = nil
@@ -144,56 +1535,552 @@ func (b *ByteRing) ReadFrom(r io.Reader) (int, error) {
 	return n, err
 }
 
-// Tail copies last len(dest) bytes into dest argument.
+// readBuf returns a pooled temporary slice of chunk bytes, together with its
+// pointer to be put back into the pool.
+func (b *ByteRing) readBuf(chunk int) (*[]byte, []byte) {
+	p, _ := b.readBufs.Get().(*[]byte)
+	if p == nil || cap(*p) < chunk {
+		p = new([]byte)
+		*p = make([]byte, chunk)
+	}
+	return p, (*p)[:chunk]
+}
+
+// Bytes returns a copy of all unread data, from the oldest to the newest.
+// The returned slice doesn't share memory with buffer.
+func (b *ByteRing) Bytes() []byte {
+	b.rlock()
+	defer b.runlock()
+	d := make([]byte, b.available())
+	b.copyAt(d, 0)
+	return d
+}
+
+// AppendTo appends all unread data, from the oldest to the newest, to dst and
+// returns the extended slice, like strconv.AppendInt.
+func (b *ByteRing) AppendTo(dst []byte) []byte {
+	b.rlock()
+	defer b.runlock()
+	first, second := b.intervals()
+	return append(append(dst, first...), second...)
+}
+
+// String returns all unread data as a string, it implements fmt.Stringer.
+func (b *ByteRing) String() string {
+	b.rlock()
+	defer b.runlock()
+	var sb strings.Builder
+	sb.Grow(b.available())
+	first, second := b.intervals()
+	sb.Write(first)
+	sb.Write(second)
+	return sb.String()
+}
+
+// Format implements fmt.Formatter. Verbs %s, %q, %x and %X format unread
+// data like a byte slice, %v works like %q. %+v also prints the internal
+// state, e.g.:
+//
+//	{start: 4, end: 4, full: true, size: 10, data: "tynZyje.pl"}
+func (b *ByteRing) Format(f fmt.State, verb rune) {
+	b.rlock()
+	start, end, full, size := b.start, b.end, b.full, b.capacity
+	d := make([]byte, b.available())
+	b.copyAt(d, 0)
+	b.runlock()
+	switch {
+	case verb == 'v' && (f.Flag('+') || f.Flag('#')):
+		fmt.Fprintf(f, "{start: %d, end: %d, full: %v, size: %d, data: %q}", start, end, full, size, d)
+	case verb == 'v':
+		fmt.Fprintf(f, "%q", d)
+	case verb == 's' || verb == 'q' || verb == 'x' || verb == 'X':
+		fmt.Fprintf(f, fmt.FormatString(f, verb), d)
+	default:
+		fmt.Fprintf(f, "%%!%c(*bytering.ByteRing)", verb)
+	}
+}
+
+// Head copies first (oldest) len(dest) bytes into dest argument.
+func (b *ByteRing) Head(dest []byte) int {
+	b.rlock()
+	defer b.runlock()
+	return b.copyAt(dest, 0)
+}
+
+// Tail copies last len(dest) bytes into dest argument. If dest is longer than
+// Available(), only the returned number of bytes at its beginning are valid,
+// the rest of dest is not changed.
 func (b *ByteRing) Tail(dest []byte) int {
-	// assert offset < size!
-	destSize := len(dest)
-	b.m.RLock()
-	defer b.m.RUnlock()
-	if destSize > b.available() {
-		destSize = b.available()
+	b.rlock()
+	defer b.runlock()
+	available := b.available()
+	if len(dest) > available {
+		dest = dest[:available]
 	}
-	if b.full && b.end != 0 {
-		_, end := b.secondInterval()
-		if destSize <= end {
-			return copy(dest, b.b[:end])
-		}
-		destStart := destSize - end
-		n := copy(dest[destStart:], b.b[:end])
-		destSize -= n
-		n += copy(dest[:destStart], b.b[b.capacity-destSize:])
-		return n
+	return b.copyAt(dest, available-len(dest))
+}
+
+// TailZeroPad works like Tail but aligns data to the end of dest, zeroing
+// the unused beginning of dest. It returns the number of bytes copied, so
+// data is dest[len(dest)-n:].
+func (b *ByteRing) TailZeroPad(dest []byte) int {
+	b.rlock()
+	defer b.runlock()
+	available := b.available()
+	pad := max(len(dest)-available, 0)
+	clear(dest[:pad])
+	return b.copyAt(dest[pad:], available-(len(dest)-pad))
+}
+
+// Peek returns a copy of the newest n bytes. If n is larger than
+// Available() all data is returned. The returned slice doesn't share memory
+// with buffer.
+func (b *ByteRing) Peek(n int) []byte {
+	b.rlock()
+	defer b.runlock()
+	available := b.available()
+	n = max(min(n, available), 0)
+	d := make([]byte, n)
+	b.copyAt(d, available-n)
+	return d
+}
+
+// PeekView works like Peek but returns the newest n bytes without copying,
+// as two slices of the underlying slice, the second one is empty unless the
+// data is wrapped.
+//
+// Like Intervals, buffer is read locked until release is called, so writes
+// wait for it, and until then the goroutine must not call back into the
+// ring's locking methods. The slices must not be modified nor used after
+// calling release. Without locking they are valid only until the next
+// change of buffer.
+func (b *ByteRing) PeekView(n int) (first, second []byte, release func()) {
+	b.rlock()
+	available := b.available()
+	n = max(min(n, available), 0)
+	first, second = b.rangeIntervals(available-n, n)
+	return first, second, b.runlock
+}
+
+// PeekAt returns a copy of n unread bytes starting at offset, where offset 0
+// means the oldest unread byte. The range is clamped to Available(), if
+// offset is out of range or n is not positive an empty slice is returned.
+// The returned slice doesn't share memory with buffer.
+func (b *ByteRing) PeekAt(offset, n int) []byte {
+	if offset < 0 || n <= 0 {
+		return []byte{}
 	}
+	b.rlock()
+	defer b.runlock()
+	first, second := b.rangeIntervals(offset, n)
+	d := make([]byte, len(first)+len(second))
+	copy(d[copy(d, first):], second)
+	return d
+}
 
-	start, end := b.firstInterval()
-	start = end - destSize
-	return copy(dest, b.b[start:end])
+// PeekN returns a copy of the oldest n unread bytes without consuming them.
+// If n is larger than Available() all data is returned. Once the bytes are
+// processed, Commit removes them from buffer. Only the last PeekN can be
+// committed.
+func (b *ByteRing) PeekN(n int) []byte {
+	b.lock()
+	defer b.unlock()
+	d := make([]byte, max(min(n, b.available()), 0))
+	b.copyAt(d, 0)
+	b.peeked = len(d)
+	b.peekGen = b.gen
+	b.peekPos = b.written - uint64(b.available())
+	b.peekLost = false
+	return d
+}
+
+// Commit discards n bytes returned by the last PeekN, n must not exceed their
+// number. If the peeked bytes were overwritten by a write or WriteAt,
+// consumed by a read, or buffer was reset or restored by Restore since,
+// Commit returns ErrPeekLost and doesn't change buffer. A successful Commit
+// invalidates the peeked bytes, so they can't be committed twice.
+func (b *ByteRing) Commit(n int) error {
+	b.lock()
+	defer b.unlock()
+	if n < 0 || n > b.peeked {
+		return errOutOfRange
+	}
+	pos := b.written - uint64(b.available())
+	if b.peekLost || b.gen != b.peekGen || pos != b.peekPos {
+		return ErrPeekLost
+	}
+	b.peeked = 0
+	b.discard(n)
+	b.behind += n
+	return nil
 }
 
 // Copy copies a len(dest) bytes into dest shifted by offset.
-// Offset equal to 0 means the beginning of data (oldest data).
+// Offset equal to 0 means the beginning of data (oldest data). It returns the
+// number of bytes copied, which is 0 for a negative offset or an offset not
+// less than Available().
 func (b *ByteRing) Copy(dest []byte, offset int) int {
-	// assert offset < size!
-	b.m.RLock()
-	defer b.m.RUnlock()
-	availableData := b.available() - offset
-	if availableData <= 0 {
+	b.rlock()
+	defer b.runlock()
+	return b.copyAt(dest, offset)
+}
+
+// CopyN works like Copy but copies at most n bytes.
+func (b *ByteRing) CopyN(dest []byte, offset, n int) int {
+	if n <= 0 {
 		return 0
 	}
-	destSize := len(dest)
-	if destSize > availableData {
-		destSize = availableData
+	b.rlock()
+	defer b.runlock()
+	return b.copyAt(dest[:min(n, len(dest))], offset)
+}
+
+// ReadAt reads len(p) bytes into p starting at offset off, where offset 0
+// means the oldest unread byte. It doesn't consume data. It implements
+// io.ReaderAt, when fewer than len(p) bytes are read err is io.EOF.
+func (b *ByteRing) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
 	}
-	s, e := b.firstInterval()
-	s += offset
-	n := 0
-	if s >= e {
-		offset =  s - e
-		s, e = b.secondInterval()
-		s += offset
-	} else if b.full && b.end != 0 && destSize > e-s {
-		n = copy(dest, b.b[s:e])
-		s, e = b.secondInterval()
-	}
-	return n + copy(dest[n:], b.b[s:e])
+	b.rlock()
+	defer b.runlock()
+	if off >= int64(b.available()) {
+		return 0, io.EOF
+	}
+	n := b.copyAt(p, int(off))
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt overwrites len(p) unread bytes starting at offset off, where offset
+// 0 means the oldest unread byte. It doesn't append data nor change
+// Available(). It implements io.WriterAt, if the range exceeds unread data
+// nothing is written and an error is returned.
+func (b *ByteRing) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	b.lock()
+	defer b.unlock()
+	if b.closed {
+		return 0, ErrClosed
+	}
+	if off > int64(b.available()-len(p)) {
+		return 0, errOutOfRange
+	}
+	b.lines.valid = false
+	if len(p) > 0 && off < int64(b.peeked) {
+		b.peekLost = true
+	}
+	first, second := b.rangeIntervals(int(off), len(p))
+	n := copy(first, p)
+	return n + copy(second, p[n:]), nil
+}
+
+// binaryVersion is the first byte of data produced by MarshalBinary.
+const binaryVersion = 1
+
+// maxUnmarshalSize is the largest buffer size accepted by UnmarshalBinary, so
+// malformed input can't make it allocate huge amounts of memory.
+const maxUnmarshalSize = 1 << 30
+
+// MarshalBinary implements encoding.BinaryMarshaler. It encodes the size of
+// buffer and all unread data, from the oldest to the newest.
+func (b *ByteRing) MarshalBinary() ([]byte, error) {
+	b.rlock()
+	defer b.runlock()
+	available := b.available()
+	d := make([]byte, 0, 1+2*binary.MaxVarintLen64+available)
+	d = append(d, binaryVersion)
+	d = binary.AppendUvarint(d, uint64(b.capacity))
+	d = binary.AppendUvarint(d, uint64(available))
+	n := len(d)
+	d = d[:n+available]
+	b.copyAt(d[n:], 0)
+	return d, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces the
+// underlying slice with a new one of the encoded size and restores data
+// encoded by MarshalBinary. Stats are cleared. Sizes larger than 1GiB are
+// rejected.
+func (b *ByteRing) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != binaryVersion {
+		return errInvalidBinary
+	}
+	data = data[1:]
+	capacity, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errInvalidBinary
+	}
+	data = data[n:]
+	available, n := binary.Uvarint(data)
+	if n <= 0 || available > capacity || available != uint64(len(data)-n) {
+		return errInvalidBinary
+	}
+	data = data[n:]
+	if capacity > maxUnmarshalSize {
+		return errInvalidBinary
+	}
+
+	b.lock()
+	defer b.unlock()
+	b.b = b.makeSlice(int(capacity))
+	b.capacity = int(capacity)
+	b.reset()
+	write(b, data)
+	b.written = 0
+	b.pending = observed{}
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder, the encoding is the same as
+// MarshalBinary.
+func (b *ByteRing) GobEncode() ([]byte, error) {
+	return b.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder, the encoding is the same as
+// UnmarshalBinary.
+func (b *ByteRing) GobDecode(data []byte) error {
+	return b.UnmarshalBinary(data)
+}
+
+// Equal reports whether both buffers hold the same unread data. Sizes and
+// internal layout of buffers don't matter.
+func (b *ByteRing) Equal(other *ByteRing) bool {
+	if b == other {
+		return true
+	}
+	// lock in a consistent order to avoid deadlock with a concurrent
+	// other.Equal(b)
+	first, second := b, other
+	if uintptr(unsafe.Pointer(first)) > uintptr(unsafe.Pointer(second)) {
+		first, second = second, first
+	}
+	first.rlock()
+	defer first.runlock()
+	second.rlock()
+	defer second.runlock()
+
+	if b.available() != other.available() {
+		return false
+	}
+	a1, a2 := b.intervals()
+	b1, b2 := other.intervals()
+	for len(a1)+len(a2) > 0 {
+		if len(a1) == 0 {
+			a1, a2 = a2, nil
+		}
+		if len(b1) == 0 {
+			b1, b2 = b2, nil
+		}
+		n := min(len(a1), len(b1))
+		if !bytes.Equal(a1[:n], b1[:n]) {
+			return false
+		}
+		a1, b1 = a1[n:], b1[n:]
+	}
+	return true
+}
+
+// IndexByte returns the offset of the first instance of c in unread data, or
+// -1 if c is not present. Offset 0 means the oldest byte.
+func (b *ByteRing) IndexByte(c byte) int {
+	b.rlock()
+	defer b.runlock()
+	return b.indexByte(c)
+}
+
+func (b *ByteRing) indexByte(c byte) int {
+	first, second := b.intervals()
+	if i := bytes.IndexByte(first, c); i >= 0 {
+		return i
+	}
+	if i := bytes.IndexByte(second, c); i >= 0 {
+		return len(first) + i
+	}
+	return -1
+}
+
+// LastIndexByte returns the offset of the last instance of c in unread data,
+// or -1 if c is not present. Offset 0 means the oldest byte.
+func (b *ByteRing) LastIndexByte(c byte) int {
+	b.rlock()
+	defer b.runlock()
+	first, second := b.intervals()
+	if i := bytes.LastIndexByte(second, c); i >= 0 {
+		return len(first) + i
+	}
+	return bytes.LastIndexByte(first, c)
+}
+
+// CountByte returns the number of instances of c in unread data.
+func (b *ByteRing) CountByte(c byte) int {
+	b.rlock()
+	defer b.runlock()
+	first, second := b.intervals()
+	sep := []byte{c}
+	return bytes.Count(first, sep) + bytes.Count(second, sep)
+}
+
+// Index returns the offset of the first instance of pattern in unread data,
+// or -1 if pattern is not present. Offset 0 means the oldest byte.
+func (b *ByteRing) Index(pattern []byte) int {
+	b.rlock()
+	defer b.runlock()
+	return b.index(pattern)
+}
+
+func (b *ByteRing) index(pattern []byte) int {
+	first, second := b.intervals()
+	if i := bytes.Index(first, pattern); i >= 0 {
+		return i
+	}
+	if len(second) == 0 {
+		return -1
+	}
+	// check matches crossing the wrap boundary
+	k := len(pattern) - 1
+	tail := first[max(len(first)-k, 0):]
+	boundary := make([]byte, 0, len(tail)+k)
+	boundary = append(boundary, tail...)
+	boundary = append(boundary, second[:min(k, len(second))]...)
+	if i := bytes.Index(boundary, pattern); i >= 0 {
+		return len(first) - len(tail) + i
+	}
+	if i := bytes.Index(second, pattern); i >= 0 {
+		return len(first) + i
+	}
+	return -1
+}
+
+// Contains reports whether pattern is within unread data.
+func (b *ByteRing) Contains(pattern []byte) bool {
+	b.rlock()
+	defer b.runlock()
+	return b.index(pattern) >= 0
+}
+
+// At returns the byte at offset i of unread data, where offset 0 means the
+// oldest byte. It returns an error if i is out of range.
+func (b *ByteRing) At(i int) (byte, error) {
+	b.rlock()
+	defer b.runlock()
+	if i < 0 || i >= b.available() {
+		return 0, errOutOfRange
+	}
+	return b.b[b.pos(i)], nil
+}
+
+// All returns an iterator over offsets and bytes of unread data, from the
+// oldest to the newest. The read lock is held during the whole iteration, the
+// loop body must not call back into the ring's locking methods, see ForEach.
+func (b *ByteRing) All() iter.Seq2[int, byte] {
+	return b.ForEach
+}
+
+// ForEach calls fn for every byte of unread data, from the oldest to the
+// newest, until fn returns false. The read lock is held during the whole
+// iteration, fn must not call back into the ring's locking methods. That
+// includes read only ones like Bytes, a recursive read lock deadlocks once a
+// writer is waiting.
+func (b *ByteRing) ForEach(fn func(offset int, c byte) bool) {
+	b.rlock()
+	defer b.runlock()
+	first, second := b.intervals()
+	for i, c := range first {
+		if !fn(i, c) {
+			return
+		}
+	}
+	for i, c := range second {
+		if !fn(len(first)+i, c) {
+			return
+		}
+	}
+}
+
+// Lines returns an iterator over lines of unread data, with '\n' stripped.
+// The last line is returned even if it doesn't end with a newline. The read
+// lock is held during the whole iteration, the loop body must not call back
+// into the ring's locking methods, see ForEach. A line may share memory with
+// the ByteRing, it must not be modified nor used after the loop iteration.
+func (b *ByteRing) Lines() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		b.rlock()
+		defer b.runlock()
+		first, second := b.intervals()
+		rest, ok := yieldLines(first, yield)
+		if !ok {
+			return
+		}
+		if len(rest) > 0 && len(second) > 0 {
+			// a line crossing the wrap boundary
+			i := bytes.IndexByte(second, '\n')
+			if i < 0 {
+				i = len(second)
+			}
+			line := make([]byte, 0, len(rest)+i)
+			line = append(line, rest...)
+			line = append(line, second[:i]...)
+			if !yield(line) || i == len(second) {
+				return
+			}
+			rest, second = nil, second[i+1:]
+		}
+		if len(second) > 0 {
+			if rest, ok = yieldLines(second, yield); !ok {
+				return
+			}
+		}
+		if len(rest) > 0 {
+			yield(rest)
+		}
+	}
+}
+
+// yieldLines passes all newline terminated lines of d to yield. It returns
+// the remaining incomplete line and false if yield stopped the iteration.
+func yieldLines(d []byte, yield func([]byte) bool) ([]byte, bool) {
+	for {
+		i := bytes.IndexByte(d, '\n')
+		if i < 0 {
+			return d, true
+		}
+		if !yield(d[:i]) {
+			return nil, false
+		}
+		d = d[i+1:]
+	}
+}
+
+// ReadLine reads and consumes the oldest newline terminated line, it returns
+// the line without the '\n'. If there is no complete line in buffer, err is
+// io.EOF and nothing is consumed.
+//
+// For a more flexible line scanning ByteRing can be also used as a source of
+// bufio.Scanner.
+func (b *ByteRing) ReadLine() ([]byte, error) {
+	b.lock()
+	defer b.unlock()
+	i := b.indexByte('\n')
+	if i < 0 {
+		return nil, io.EOF
+	}
+	line := make([]byte, i)
+	b.copyAt(line, 0)
+	b.discard(i + 1)
+	b.behind += i + 1
+	return line, nil
+}
+
+// Checksum returns the CRC-32 checksum (IEEE polynomial) of unread data.
+func (b *ByteRing) Checksum() uint32 {
+	b.rlock()
+	defer b.runlock()
+	first, second := b.intervals()
+	return crc32.Update(crc32.ChecksumIEEE(first), crc32.IEEETable, second)
 }
@@ -1,8 +1,26 @@
 package bytering
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestInit(t *testing.T) {
@@ -19,21 +37,21 @@ func TestInit(t *testing.T) {
 	}
 }
 
-func TestExtensive(t *testing.T) {
-	var data = []struct {
-		Name    string
-		BufSize int
-		In      []string
-		Want    string
-	}{
-		{"One write smaller than buffer", 10, []string{"Olsztyn"}, "Olsztyn"},
-		{"Bigger than buffer", 10, []string{"OlsztynZyje.pl"}, "tynZyje.pl"},
-		{"Double write", 10, []string{"Olsztyn", "Zyje.pl"}, "tynZyje.pl"},
-		{"big multi write", 10, []string{"Olszt", "ynZyje.pl", " - poz", "ytywna", " stron", "a Olsz", "tyna"}, "a Olsztyna"},
-	}
+var extensiveData = []struct {
+	Name    string
+	BufSize int
+	In      []string
+	Want    string
+}{
+	{"One write smaller than buffer", 10, []string{"Olsztyn"}, "Olsztyn"},
+	{"Bigger than buffer", 10, []string{"OlsztynZyje.pl"}, "tynZyje.pl"},
+	{"Double write", 10, []string{"Olsztyn", "Zyje.pl"}, "tynZyje.pl"},
+	{"big multi write", 10, []string{"Olszt", "ynZyje.pl", " - poz", "ytywna", " stron", "a Olsz", "tyna"}, "a Olsztyna"},
+}
 
+func TestExtensive(t *testing.T) {
 	bbuf := &bytes.Buffer{}
-	for i, d := range data {
+	for i, d := range extensiveData {
 		buf := NewByteRing(d.BufSize)
 		for j, in := range d.In {
 			if n, err := buf.Write([]byte(in)); err != nil {
@@ -76,3 +94,3412 @@ func TestExtensive(t *testing.T) {
 		}
 	}
 }
+
+func TestReadFrom(t *testing.T) {
+	in := strings.Repeat("0123456789", 100) + "Olsztyn"
+	buf := NewByteRing(10)
+	n, err := buf.ReadFrom(strings.NewReader(in))
+	if err != nil {
+		t.Errorf("ReadFrom returned err: %s", err)
+	}
+	if n != int64(len(in)) {
+		t.Errorf("ReadFrom n want: %d, got: %d", len(in), n)
+	}
+	bbuf := &bytes.Buffer{}
+	buf.WriteTo(bbuf)
+	if want, got := in[len(in)-10:], bbuf.String(); want != got {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestReadFromError(t *testing.T) {
+	errBoom := errors.New("boom")
+	buf := NewByteRing(10)
+	r := io.MultiReader(strings.NewReader("Olsztyn"), iotest.ErrReader(errBoom))
+	n, err := buf.ReadFrom(r)
+	if err != errBoom {
+		t.Errorf("ReadFrom err want: %v, got: %v", errBoom, err)
+	}
+	if n != 7 {
+		t.Errorf("ReadFrom n want: %d, got: %d", 7, n)
+	}
+	bbuf := &bytes.Buffer{}
+	buf.WriteTo(bbuf)
+	if want, got := "Olsztyn", bbuf.String(); want != got {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestWriteReturnsLen(t *testing.T) {
+	var data = []struct {
+		Name string
+		Pre  string
+		In   string
+		Want string
+	}{
+		{"Equal to capacity", "", "0123456789", "0123456789"},
+		{"Bigger than capacity", "", "OlsztynZyje.pl", "tynZyje.pl"},
+		{"Wrap-around partial", "Olsztyn", "Zyje", "lsztynZyje"},
+		{"Wrap-around to the end", "Olsztyn", "Zyj", "OlsztynZyj"},
+	}
+
+	bbuf := &bytes.Buffer{}
+	for i, d := range data {
+		buf := NewByteRing(10)
+		buf.Write([]byte(d.Pre))
+		if n, err := buf.Write([]byte(d.In)); err != nil {
+			t.Errorf("[%d] %q err when writing: %s", i, d.Name, err)
+		} else if n != len(d.In) {
+			t.Errorf("[%d] %q Write n want: %d, got: %d", i, d.Name, len(d.In), n)
+		}
+		bbuf.Reset()
+		buf.WriteTo(bbuf)
+		if got := bbuf.String(); d.Want != got {
+			t.Errorf("[%d] %q WriteTo want: %q, got: %q", i, d.Name, d.Want, got)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	buf := NewByteRing(10)
+	p := make([]byte, 4)
+	buf.Write([]byte("Olsztyn"))
+	if n, err := buf.Read(p); err != nil || string(p[:n]) != "Olsz" {
+		t.Errorf("Read want: %q, got: %q, err: %v", "Olsz", p[:n], err)
+	}
+	if want, got := 3, buf.Available(); want != got {
+		t.Errorf("Available want: %d, got: %d", want, got)
+	}
+	buf.Write([]byte("Zyje.pl"))
+	var data = []string{"tynZ", "yje.", "pl"}
+	for i, want := range data {
+		if n, err := buf.Read(p); err != nil || string(p[:n]) != want {
+			t.Errorf("[%d] Read want: %q, got: %q, err: %v", i, want, p[:n], err)
+		}
+	}
+	if n, err := buf.Read(p); n != 0 || err != io.EOF {
+		t.Errorf("Read on drained buffer want: 0, EOF, got: %d, %v", n, err)
+	}
+	if n, err := buf.Read(nil); n != 0 || err != nil {
+		t.Errorf("Read with empty slice want: 0, nil, got: %d, %v", n, err)
+	}
+}
+
+func TestReadOverrun(t *testing.T) {
+	buf := NewByteRing(10)
+	p := make([]byte, 3)
+	buf.Write([]byte("Olsztyn"))
+	buf.Read(p)
+	// 4 unread bytes "ztyn", writing 8 more overwrites 2 of them
+	buf.Write([]byte("Zyje.pl!"))
+	if want, got := 10, buf.Available(); want != got {
+		t.Errorf("Available want: %d, got: %d", want, got)
+	}
+	bbuf := &bytes.Buffer{}
+	// io.Copy would use WriteTo, which doesn't consume data
+	if _, err := bbuf.ReadFrom(buf); err != nil {
+		t.Errorf("ReadFrom err: %s", err)
+	}
+	if want, got := "ynZyje.pl!", bbuf.String(); want != got {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+	if want, got := 0, buf.Available(); want != got {
+		t.Errorf("Available after drain want: %d, got: %d", want, got)
+	}
+
+	buf.Write([]byte("Olsztyn"))
+	bbuf.Reset()
+	buf.WriteTo(bbuf)
+	if want, got := "Olsztyn", bbuf.String(); want != got {
+		t.Errorf("WriteTo after drain want: %q, got: %q", want, got)
+	}
+	b := make([]byte, 3)
+	buf.Tail(b)
+	if want, got := "tyn", string(b); want != got {
+		t.Errorf("Tail after drain want: %q, got: %q", want, got)
+	}
+}
+
+func TestWriteByte(t *testing.T) {
+	in := "OlsztynZyje.pl"
+	buf := NewByteRing(len(in) - 5)
+	for i := 0; i < len(in); i++ {
+		if err := buf.WriteByte(in[i]); err != nil {
+			t.Errorf("[%d] WriteByte err: %s", i, err)
+		}
+	}
+	bbuf := &bytes.Buffer{}
+	buf.WriteTo(bbuf)
+	if want, got := in[5:], bbuf.String(); want != got {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+	if n := testing.AllocsPerRun(100, func() { buf.WriteByte('x') }); n != 0 {
+		t.Errorf("WriteByte allocs want: 0, got: %v", n)
+	}
+}
+
+func BenchmarkWriteByte(b *testing.B) {
+	buf := NewByteRing(1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.WriteByte(byte(i))
+	}
+}
+
+func BenchmarkWriteOneByteSlice(b *testing.B) {
+	buf := NewByteRing(1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Write([]byte{byte(i)})
+	}
+}
+
+func TestReadByte(t *testing.T) {
+	buf := NewByteRing(10)
+	if err := buf.UnreadByte(); err != ErrInvalidUnreadByte {
+		t.Errorf("UnreadByte on fresh buffer want: %v, got: %v", ErrInvalidUnreadByte, err)
+	}
+	buf.Write([]byte("Ols"))
+	for i, want := range []byte("Ols") {
+		if c, err := buf.ReadByte(); err != nil || c != want {
+			t.Errorf("[%d] ReadByte want: %q, got: %q, err: %v", i, want, c, err)
+		}
+	}
+	if c, err := buf.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte on drained buffer want: EOF, got: %q, %v", c, err)
+	}
+	if err := buf.UnreadByte(); err != nil {
+		t.Errorf("UnreadByte err: %s", err)
+	}
+	if c, err := buf.ReadByte(); err != nil || c != 's' {
+		t.Errorf("ReadByte after UnreadByte want: %q, got: %q, err: %v", 's', c, err)
+	}
+}
+
+func TestUnreadByteOverwritten(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.Write([]byte("Olsztyn"))
+	buf.ReadByte()
+	// fills the whole buffer, the slot of read 'O' gets reused
+	buf.Write([]byte("Zyje"))
+	if err := buf.UnreadByte(); err != ErrInvalidUnreadByte {
+		t.Errorf("UnreadByte after overwrite want: %v, got: %v", ErrInvalidUnreadByte, err)
+	}
+
+	buf.Reset()
+	buf.Write([]byte("Olsztyn"))
+	buf.ReadByte()
+	buf.Write([]byte("Zyj"))
+	if err := buf.UnreadByte(); err != nil {
+		t.Errorf("UnreadByte err: %s", err)
+	}
+	if want, got := 10, buf.Available(); want != got {
+		t.Errorf("Available want: %d, got: %d", want, got)
+	}
+	bbuf := &bytes.Buffer{}
+	buf.WriteTo(bbuf)
+	if want, got := "OlsztynZyj", bbuf.String(); want != got {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestWriteString(t *testing.T) {
+	bbuf := &bytes.Buffer{}
+	for i, d := range extensiveData {
+		buf := NewByteRing(d.BufSize)
+		for j, in := range d.In {
+			if n, err := buf.WriteString(in); err != nil {
+				t.Errorf("[%d] err when writing [%d] text: %s", i, j, err)
+			} else if n != len(in) {
+				t.Errorf("[%d] could not write full [%d] text, want: %d, got %d", i, j, len(in), n)
+			}
+		}
+		bbuf.Reset()
+		buf.WriteTo(bbuf)
+		if got := bbuf.String(); d.Want != got {
+			t.Errorf("[%d] %q with size %d, WriteTo want: %q, got: %q", i, d.Name, d.BufSize, d.Want, got)
+		}
+	}
+}
+
+var benchText = "Olsztyn - pozytywna strona Olsztyna"
+
+func BenchmarkWriteString(b *testing.B) {
+	buf := NewByteRing(1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.WriteString(benchText)
+	}
+}
+
+func BenchmarkWriteConvertedString(b *testing.B) {
+	buf := NewByteRing(1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Write([]byte(benchText))
+	}
+}
+
+func TestBytes(t *testing.T) {
+	for i, d := range extensiveData {
+		buf := NewByteRing(d.BufSize)
+		for _, in := range d.In {
+			buf.WriteString(in)
+		}
+		if got := buf.Bytes(); d.Want != string(got) {
+			t.Errorf("[%d] %q with size %d, Bytes want: %q, got: %q", i, d.Name, d.BufSize, d.Want, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	buf := NewByteRing(4)
+	buf.WriteString("hello")
+	if want, got := "ello", buf.String(); want != got {
+		t.Errorf("String want: %q, got: %q", want, got)
+	}
+	buf = NewByteRing(10)
+	buf.WriteString("hello")
+	if want, got := "hello", fmt.Sprintf("%s", buf); want != got {
+		t.Errorf("%%s want: %q, got: %q", want, got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	var data = []struct {
+		Format string
+		Want   string
+	}{
+		{"%s", "tynZyje.pl"},
+		{"%12s", "  tynZyje.pl"},
+		{"%v", `"tynZyje.pl"`},
+		{"%q", `"tynZyje.pl"`},
+		{"%x", "74796e5a796a652e706c"},
+		{"% X", "74 79 6E 5A 79 6A 65 2E 70 6C"},
+		{"%+v", `{start: 4, end: 4, full: true, size: 10, data: "tynZyje.pl"}`},
+		{"%d", "%!d(*bytering.ByteRing)"},
+	}
+	for i, d := range data {
+		if got := fmt.Sprintf(d.Format, buf); d.Want != got {
+			t.Errorf("[%d] %s want: %q, got: %q", i, d.Format, d.Want, got)
+		}
+	}
+}
+
+func TestPeek(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("OlsztynZyje.pl")
+	var data = []struct {
+		N    int
+		Want string
+	}{
+		{-1, ""},
+		{0, ""},
+		{3, ".pl"},
+		{10, "tynZyje.pl"},
+		{12, "tynZyje.pl"},
+	}
+	for i, d := range data {
+		got := buf.Peek(d.N)
+		if got == nil {
+			t.Errorf("[%d] Peek(%d) returned nil", i, d.N)
+		}
+		if d.Want != string(got) {
+			t.Errorf("[%d] Peek(%d) want: %q, got: %q", i, d.N, d.Want, got)
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	for i, d := range extensiveData {
+		buf := NewByteRing(d.BufSize)
+		for _, in := range d.In {
+			buf.WriteString(in)
+		}
+		b := make([]byte, 4)
+		if n := buf.Head(b); n != len(b) || d.Want[:4] != string(b) {
+			t.Errorf("[%d] %q Head want: %q, got: %q", i, d.Name, d.Want[:4], b[:n])
+		}
+		b = make([]byte, len(d.Want)+2)
+		if n := buf.Head(b); n != len(d.Want) || d.Want != string(b[:n]) {
+			t.Errorf("[%d] %q Head want: %q, got: %q", i, d.Name, d.Want, b[:n])
+		}
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("OlsztynZyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	if n := buf.Discard(2); n != 2 {
+		t.Errorf("Discard want: %d, got: %d", 2, n)
+	}
+	buf.WriteString("!")
+	// discarding across the wrap boundary
+	if n := buf.Discard(6); n != 6 {
+		t.Errorf("Discard want: %d, got: %d", 6, n)
+	}
+	if want, got := 3, buf.Available(); want != got {
+		t.Errorf("Available want: %d, got: %d", want, got)
+	}
+	bbuf := &bytes.Buffer{}
+	buf.WriteTo(bbuf)
+	if want, got := "pl!", bbuf.String(); want != got {
+		t.Errorf("WriteTo want: %q, got: %q", want, got)
+	}
+	b := make([]byte, 2)
+	if buf.Tail(b); string(b) != "l!" {
+		t.Errorf("Tail want: %q, got: %q", "l!", b)
+	}
+	if buf.Copy(b, 0); string(b) != "pl" {
+		t.Errorf("Copy want: %q, got: %q", "pl", b)
+	}
+	if n := buf.Discard(5); n != 3 {
+		t.Errorf("Discard want: %d, got: %d", 3, n)
+	}
+	if want, got := 0, buf.Available(); want != got {
+		t.Errorf("Available want: %d, got: %d", want, got)
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("OlsztynZyje.pl")
+	want := "tynZyje.pl"
+	b := make([]byte, 3)
+	c := make([]byte, 3)
+	for off := 0; off <= len(want)-len(b); off++ {
+		n, err := buf.ReadAt(b, int64(off))
+		if err != nil || n != len(b) {
+			t.Errorf("ReadAt(%d) want: %d, nil, got: %d, %v", off, len(b), n, err)
+		}
+		buf.Copy(c, off)
+		if !bytes.Equal(b, c) || string(b) != want[off:off+len(b)] {
+			t.Errorf("ReadAt(%d) want: %q, got: %q, Copy: %q", off, want[off:off+len(b)], b, c)
+		}
+	}
+	if n, err := buf.ReadAt(b, 8); n != 2 || err != io.EOF || string(b[:n]) != "pl" {
+		t.Errorf("ReadAt at the end want: %q, EOF, got: %q, %v", "pl", b[:n], err)
+	}
+	if n, err := buf.ReadAt(b, 10); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt past the end want: 0, EOF, got: %d, %v", n, err)
+	}
+	if _, err := buf.ReadAt(b, -1); err == nil {
+		t.Errorf("ReadAt with negative offset want error")
+	}
+	sr := io.NewSectionReader(buf, 3, 4)
+	if got, err := io.ReadAll(sr); err != nil || string(got) != "Zyje" {
+		t.Errorf("SectionReader want: %q, got: %q, %v", "Zyje", got, err)
+	}
+}
+
+func TestIsFullIsEmpty(t *testing.T) {
+	buf := NewByteRing(10)
+	if !buf.IsEmpty() || buf.IsFull() {
+		t.Errorf("fresh buffer want empty, got IsEmpty: %v, IsFull: %v", buf.IsEmpty(), buf.IsFull())
+	}
+	buf.WriteString("Olsztyn")
+	if buf.IsEmpty() || buf.IsFull() {
+		t.Errorf("partially filled buffer want neither, got IsEmpty: %v, IsFull: %v", buf.IsEmpty(), buf.IsFull())
+	}
+	buf.WriteString("Zyje.pl")
+	if buf.IsEmpty() || !buf.IsFull() {
+		t.Errorf("wrapped buffer want full, got IsEmpty: %v, IsFull: %v", buf.IsEmpty(), buf.IsFull())
+	}
+	buf.Discard(10)
+	if !buf.IsEmpty() || buf.IsFull() {
+		t.Errorf("drained buffer want empty, got IsEmpty: %v, IsFull: %v", buf.IsEmpty(), buf.IsFull())
+	}
+}
+
+func TestClone(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("OlsztynZyje.pl")
+	c := buf.Clone()
+	if want, got := "tynZyje.pl", string(c.Bytes()); want != got {
+		t.Errorf("Clone want: %q, got: %q", want, got)
+	}
+	c.WriteString("Olsz")
+	c.ReadByte()
+	if want, got := "tynZyje.pl", string(buf.Bytes()); want != got {
+		t.Errorf("original after writing into clone want: %q, got: %q", want, got)
+	}
+	if want, got := "je.plOlsz", string(c.Bytes()); want != got {
+		t.Errorf("clone want: %q, got: %q", want, got)
+	}
+
+	var tee bytes.Buffer
+	buf = NewByteRing(10, WithLineIndex(), WithTee(&tee))
+	buf.WriteString("Ol\nsz")
+	c = buf.Clone()
+	c.WriteString("\n")
+	if !c.lines.enabled || tee.String() != "Ol\nsz\n" {
+		t.Errorf("Clone options want: line index, tee %q, got: %v, %q", "Ol\nsz\n", c.lines.enabled, tee.String())
+	}
+	buf.Close()
+	if _, err := buf.Clone().WriteString("x"); err != ErrClosed {
+		t.Errorf("Write into clone of closed want: %v, got: %v", ErrClosed, err)
+	}
+}
+
+func TestResize(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("OlsztynZyje.pl")
+	if err := buf.Resize(20); err != nil {
+		t.Errorf("Resize err: %s", err)
+	}
+	if buf.Size() != 20 || buf.IsFull() {
+		t.Errorf("grown buffer want size 20 and not full, got: %d, %v", buf.Size(), buf.IsFull())
+	}
+	if want, got := "tynZyje.pl", string(buf.Bytes()); want != got {
+		t.Errorf("grown buffer want: %q, got: %q", want, got)
+	}
+	buf.WriteString(" - poz")
+	if want, got := "tynZyje.pl - poz", string(buf.Bytes()); want != got {
+		t.Errorf("grown buffer after write want: %q, got: %q", want, got)
+	}
+
+	if err := buf.Resize(4); err != nil {
+		t.Errorf("Resize err: %s", err)
+	}
+	if buf.Size() != 4 || !buf.IsFull() {
+		t.Errorf("shrunk buffer want size 4 and full, got: %d, %v", buf.Size(), buf.IsFull())
+	}
+	if want, got := " poz", string(buf.Bytes()); want != got {
+		t.Errorf("shrunk buffer want: %q, got: %q", want, got)
+	}
+	buf.WriteString("ytywna")
+	if want, got := "ywna", string(buf.Bytes()); want != got {
+		t.Errorf("shrunk buffer after write want: %q, got: %q", want, got)
+	}
+
+	if err := buf.Resize(-1); err == nil {
+		t.Errorf("Resize with negative size want error")
+	}
+}
+
+func TestGrow(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("OlsztynZyje.pl")
+	backing := &buf.b[0]
+	buf.Grow(10)
+	if &buf.b[0] != backing || buf.Size() != 10 {
+		t.Errorf("Grow within size must not reallocate")
+	}
+	buf.Grow(15)
+	if want, got := 20, buf.Size(); want != got {
+		t.Errorf("Size after Grow want: %d, got: %d", want, got)
+	}
+	if want, got := "tynZyje.pl", string(buf.Bytes()); want != got {
+		t.Errorf("Grow want: %q, got: %q", want, got)
+	}
+	buf.Grow(50)
+	if want, got := 50, buf.Size(); want != got {
+		t.Errorf("Size after Grow want: %d, got: %d", want, got)
+	}
+	if want, got := "tynZyje.pl", string(buf.Bytes()); want != got {
+		t.Errorf("Grow want: %q, got: %q", want, got)
+	}
+}
+
+func TestResetZero(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("OlsztynZyje.pl")
+	buf.ResetZero()
+	if want, got := 0, buf.Available(); want != got {
+		t.Errorf("Available want: %d, got: %d", want, got)
+	}
+	if !bytes.Equal(buf.b, make([]byte, 10)) {
+		t.Errorf("ResetZero left data in memory: %q", buf.b)
+	}
+}
+
+func TestNewByteRingFromSlice(t *testing.T) {
+	d := make([]byte, 10)
+	buf := NewByteRingFromSlice(d)
+	if want, got := len(d), buf.Size(); want != got {
+		t.Errorf("Size want: %d, got: %d", want, got)
+	}
+	if !buf.IsEmpty() {
+		t.Errorf("new buffer is not empty")
+	}
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl")
+	if want, got := "e.pltynZyj", string(d); want != got {
+		t.Errorf("underlying slice want: %q, got: %q", want, got)
+	}
+	if want, got := "tynZyje.pl", string(buf.Bytes()); want != got {
+		t.Errorf("Bytes want: %q, got: %q", want, got)
+	}
+}
+
+func TestStats(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	if w, d := buf.Stats(); w != 7 || d != 0 {
+		t.Errorf("Stats want: 7, 0, got: %d, %d", w, d)
+	}
+	buf.Discard(2)
+	buf.WriteString("Zyje.pl")
+	if w, d := buf.Stats(); w != 14 || d != 2 {
+		t.Errorf("Stats want: 14, 2, got: %d, %d", w, d)
+	}
+
+	buf.Reset()
+	if w, d := buf.Stats(); w != 0 || d != 0 {
+		t.Errorf("Stats after Reset want: 0, 0, got: %d, %d", w, d)
+	}
+	buf.WriteString(strings.Repeat("x", 10))
+	buf.WriteByte('x')
+	buf.Write(bytes.Repeat([]byte("x"), 19))
+	if w, d := buf.Stats(); w != 30 || d != 20 {
+		t.Errorf("Stats want: 30, 20, got: %d, %d", w, d)
+	}
+}
+
+func TestOnOverflow(t *testing.T) {
+	var got []string
+	buf := NewByteRing(10)
+	buf.OnOverflow(func(dropped []byte) {
+		got = append(got, string(dropped))
+		// the ByteRing is not locked during the call
+		buf.Available()
+	})
+	buf.WriteString("Olsztyn")
+	buf.ReadByte()
+	buf.WriteString("Zyje") // exactly fills buffer
+	buf.WriteString(".pl")
+	buf.WriteByte('!')
+	buf.Write([]byte("pozytywna strona"))
+	want := []string{"lsz", "t", "ynZyje.pl!pozyty"}
+	if fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("dropped want: %q, got: %q", want, got)
+	}
+	if w, d := buf.Stats(); int(d) != len(strings.Join(want, "")) {
+		t.Errorf("Stats dropped want: %d, got: %d (written: %d)", len(strings.Join(want, "")), d, w)
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	for i, d := range extensiveData {
+		buf := NewByteRing(d.BufSize)
+		for _, in := range d.In {
+			buf.WriteString(in)
+		}
+		buf.Discard(1)
+		data, err := buf.MarshalBinary()
+		if err != nil {
+			t.Errorf("[%d] %q MarshalBinary err: %s", i, d.Name, err)
+			continue
+		}
+		got := NewByteRing(1)
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Errorf("[%d] %q UnmarshalBinary err: %s", i, d.Name, err)
+			continue
+		}
+		if got.Size() != buf.Size() || got.Available() != buf.Available() {
+			t.Errorf("[%d] %q Size, Available want: %d, %d, got: %d, %d", i, d.Name, buf.Size(), buf.Available(), got.Size(), got.Available())
+		}
+		if want := d.Want[1:]; want != string(got.Bytes()) {
+			t.Errorf("[%d] %q Bytes want: %q, got: %q", i, d.Name, want, got.Bytes())
+		}
+		got.WriteString("!")
+		buf.WriteString("!")
+		if want := string(buf.Bytes()); want != string(got.Bytes()) {
+			t.Errorf("[%d] %q Bytes after write want: %q, got: %q", i, d.Name, want, got.Bytes())
+		}
+	}
+}
+
+func TestUnmarshalBinaryMalformed(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	data, _ := buf.MarshalBinary()
+	var malformed = [][]byte{
+		nil,
+		{},
+		{0},
+		{binaryVersion},
+		{binaryVersion, 0x80},
+		{binaryVersion, 2, 3, 'a', 'b', 'c'},
+		{binaryVersion, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0},
+		binary.AppendUvarint([]byte{binaryVersion}, 1<<62), // no available
+		append(binary.AppendUvarint([]byte{binaryVersion}, 1<<62), 0),
+		append(binary.AppendUvarint([]byte{binaryVersion}, 1<<40), 0),
+		append(binary.AppendUvarint([]byte{binaryVersion}, maxUnmarshalSize+1), 0),
+		data[:len(data)-1],
+		append(data, 'x'),
+	}
+	for i, d := range malformed {
+		got := NewByteRing(10)
+		if err := got.UnmarshalBinary(d); err == nil {
+			t.Errorf("[%d] UnmarshalBinary(%v) want error", i, d)
+		}
+	}
+}
+
+func TestGob(t *testing.T) {
+	type log struct {
+		Name string
+		Buf  *ByteRing
+	}
+	in := log{"Olsztyn", NewByteRing(10)}
+	in.Buf.WriteString("OlsztynZyje.pl")
+	bbuf := &bytes.Buffer{}
+	if err := gob.NewEncoder(bbuf).Encode(in); err != nil {
+		t.Fatalf("Encode err: %s", err)
+	}
+	var out log
+	if err := gob.NewDecoder(bbuf).Decode(&out); err != nil {
+		t.Fatalf("Decode err: %s", err)
+	}
+	if out.Name != in.Name || out.Buf.Size() != in.Buf.Size() {
+		t.Errorf("want: %q, %d, got: %q, %d", in.Name, in.Buf.Size(), out.Name, out.Buf.Size())
+	}
+	if want, got := "tynZyje.pl", string(out.Buf.Bytes()); want != got {
+		t.Errorf("Bytes want: %q, got: %q", want, got)
+	}
+	out.Buf.WriteString("!")
+	if want, got := "ynZyje.pl!", string(out.Buf.Bytes()); want != got {
+		t.Errorf("Bytes after write want: %q, got: %q", want, got)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	direct := NewByteRing(20)
+	direct.WriteString("tynZyje.pl")
+	wrapped := NewByteRing(10)
+	wrapped.WriteString("Olsztyn")
+	wrapped.WriteString("Zyje.pl")
+	read := NewByteRing(12)
+	read.WriteString("Olsztyn")
+	read.Discard(4)
+	read.WriteString("Zyje.pl")
+	if !direct.Equal(wrapped) || !wrapped.Equal(direct) {
+		t.Errorf("%q and %q want equal", direct, wrapped)
+	}
+	if !read.Equal(wrapped) || !direct.Equal(read) {
+		t.Errorf("%q and %q want equal", read, wrapped)
+	}
+	if !wrapped.Equal(wrapped) {
+		t.Errorf("buffer must be equal to itself")
+	}
+	wrapped.WriteString("!")
+	if direct.Equal(wrapped) {
+		t.Errorf("%q and %q want not equal", direct, wrapped)
+	}
+	direct.Discard(1)
+	direct.WriteString("?")
+	if direct.Equal(wrapped) {
+		t.Errorf("%q and %q want not equal", direct, wrapped)
+	}
+}
+
+func TestIndexByte(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	var data = []struct {
+		C    byte
+		Want int
+	}{
+		{'t', 0},
+		{'y', 1},
+		{'j', 5},
+		{'e', 6},
+		{'l', 9},
+		{'O', -1},
+	}
+	for i, d := range data {
+		if got := buf.IndexByte(d.C); d.Want != got {
+			t.Errorf("[%d] IndexByte(%q) want: %d, got: %d", i, d.C, d.Want, got)
+		}
+	}
+}
+
+var indexData = []struct {
+	Pattern string
+	Want    int
+}{
+	{"", 0},
+	{"ty", 0},
+	{"e.p", 6},   // crosses the wrap boundary
+	{"Zyje.", 3}, // crosses the wrap boundary
+	{"pl", 8},
+	{"tynZyje.pl", 0},
+	{"tynZyje.pl!", -1},
+	{"Zyje.pl", 3},
+	{"Olsztyn", -1},
+	{"yjt", -1},
+}
+
+func TestIndex(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	for i, d := range indexData {
+		if got := buf.Index([]byte(d.Pattern)); d.Want != got {
+			t.Errorf("[%d] Index(%q) want: %d, got: %d", i, d.Pattern, d.Want, got)
+		}
+	}
+	buf.Reset()
+	buf.WriteString("xxxxxxxxx\r")
+	buf.WriteString("\nyy") // "xxxxxx\r\nyy", physically "\nyyxxxxxx\r"
+	if want, got := 6, buf.Index([]byte("\r\n")); want != got {
+		t.Errorf("Index(\\r\\n) want: %d, got: %d", want, got)
+	}
+}
+
+func TestContains(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	for i, d := range indexData {
+		if want, got := d.Want >= 0, buf.Contains([]byte(d.Pattern)); want != got {
+			t.Errorf("[%d] Contains(%q) want: %v, got: %v", i, d.Pattern, want, got)
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl")
+	buf.ReadByte()
+	d := buf.Bytes()
+	for i := range d {
+		if c, err := buf.At(i); err != nil || c != d[i] {
+			t.Errorf("At(%d) want: %q, got: %q, err: %v", i, d[i], c, err)
+		}
+	}
+	for _, i := range []int{-1, len(d), 10} {
+		if _, err := buf.At(i); err == nil {
+			t.Errorf("At(%d) want error", i)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl")
+	var got []byte
+	for i, c := range buf.All() {
+		if i != len(got) {
+			t.Errorf("All offset want: %d, got: %d", len(got), i)
+		}
+		got = append(got, c)
+	}
+	if want := buf.Bytes(); !bytes.Equal(want, got) {
+		t.Errorf("All want: %q, got: %q", want, got)
+	}
+
+	got = got[:0]
+	for _, c := range buf.All() {
+		if c == 'e' {
+			break
+		}
+		got = append(got, c)
+	}
+	if want := "tynZyj"; want != string(got) {
+		t.Errorf("All with break want: %q, got: %q", want, got)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl")
+	var got []byte
+	buf.ForEach(func(offset int, c byte) bool {
+		if offset != len(got) {
+			t.Errorf("ForEach offset want: %d, got: %d", len(got), offset)
+		}
+		got = append(got, c)
+		return true
+	})
+	if want := "tynZyje.pl"; want != string(got) {
+		t.Errorf("ForEach want: %q, got: %q", want, got)
+	}
+
+	got = got[:0]
+	buf.ForEach(func(offset int, c byte) bool {
+		got = append(got, c)
+		return offset < 7
+	})
+	if want := "tynZyje."; want != string(got) {
+		t.Errorf("ForEach with early stop want: %q, got: %q", want, got)
+	}
+}
+
+func TestLines(t *testing.T) {
+	var data = []struct {
+		Name string
+		In   []string
+		Want []string
+	}{
+		{"Empty", nil, nil},
+		{"Not wrapped", []string{"a\nbb\nccc"}, []string{"a", "bb", "ccc"}},
+		{"Newline at the end", []string{"a\nbb\nccc\n"}, []string{"a", "bb", "ccc"}},
+		{"Empty lines", []string{"\na\n\nbb"}, []string{"", "a", "", "bb"}},
+		{"Line crossing wrap", []string{"xxxxxxa\nb", "b\nccc"}, []string{"a", "bb", "ccc"}},
+		{"Newline at wrap", []string{"xxxxa\nbb\n", "ccc"}, []string{"a", "bb", "ccc"}},
+		{"Last line crossing wrap", []string{"xxxxxa\nbbcc", "c"}, []string{"a", "bbccc"}},
+		{"Single line", []string{"xxxxxaaaaaa", "bbb"}, []string{"aaaaaabbb"}},
+	}
+	for i, d := range data {
+		buf := NewByteRing(10)
+		for _, in := range d.In {
+			buf.WriteString(in)
+		}
+		// skip padding used to wrap data
+		for c, err := buf.At(0); err == nil && c == 'x'; c, err = buf.At(0) {
+			buf.Discard(1)
+		}
+		var got []string
+		for line := range buf.Lines() {
+			got = append(got, string(line))
+		}
+		if fmt.Sprint(d.Want) != fmt.Sprint(got) {
+			t.Errorf("[%d] %q Lines want: %q, got: %q", i, d.Name, d.Want, got)
+		}
+	}
+
+	buf := NewByteRing(10)
+	buf.WriteString("a\nbb\nccc")
+	var got []string
+	for line := range buf.Lines() {
+		got = append(got, string(line))
+		if len(got) == 2 {
+			break
+		}
+	}
+	if want := []string{"a", "bb"}; fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("Lines with break want: %q, got: %q", want, got)
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("a\nb")
+	if line, err := buf.ReadLine(); err != nil || string(line) != "a" {
+		t.Errorf("ReadLine want: %q, got: %q, %v", "a", line, err)
+	}
+	if line, err := buf.ReadLine(); err != io.EOF {
+		t.Errorf("ReadLine want: EOF, got: %q, %v", line, err)
+	}
+	buf.WriteString("b\n\ncc")
+	buf.WriteString("cc\n")
+	for i, want := range []string{"bb", "", "cccc"} {
+		if line, err := buf.ReadLine(); err != nil || string(line) != want {
+			t.Errorf("[%d] ReadLine want: %q, got: %q, %v", i, want, line, err)
+		}
+	}
+	if line, err := buf.ReadLine(); err != io.EOF {
+		t.Errorf("ReadLine want: EOF, got: %q, %v", line, err)
+	}
+	if want, got := 0, buf.Available(); want != got {
+		t.Errorf("Available want: %d, got: %d", want, got)
+	}
+}
+
+func TestBufioScanner(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("a\nbb\nccc")
+	var got []string
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		got = append(got, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Errorf("Scanner err: %s", err)
+	}
+	if want := []string{"a", "bb", "ccc"}; fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("Scanner want: %q, got: %q", want, got)
+	}
+}
+
+func TestUnsafe(t *testing.T) {
+	for i, d := range extensiveData {
+		buf := NewByteRingUnsafe(d.BufSize)
+		for _, in := range d.In {
+			buf.WriteString(in)
+		}
+		if got := buf.Bytes(); d.Want != string(got) {
+			t.Errorf("[%d] %q with size %d, Bytes want: %q, got: %q", i, d.Name, d.BufSize, d.Want, got)
+		}
+		b := make([]byte, 4)
+		if buf.Tail(b); d.Want[len(d.Want)-4:] != string(b) {
+			t.Errorf("[%d] %q with size %d, Tail want: %q, got: %q", i, d.Name, d.BufSize, d.Want[len(d.Want)-4:], b)
+		}
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	buf := NewByteRing(1024)
+	d := []byte(benchText)
+	for i := 0; i < b.N; i++ {
+		buf.Write(d)
+	}
+}
+
+func BenchmarkWriteUnsafe(b *testing.B) {
+	buf := NewByteRingUnsafe(1024)
+	d := []byte(benchText)
+	for i := 0; i < b.N; i++ {
+		buf.Write(d)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	buf := NewByteRing(10, WithoutLocking())
+	if !buf.nolock {
+		t.Errorf("WithoutLocking didn't disable locking")
+	}
+	buf.WriteString("OlsztynZyje.pl")
+	if want, got := "tynZyje.pl", string(buf.Bytes()); want != got {
+		t.Errorf("WithoutLocking want: %q, got: %q", want, got)
+	}
+
+	var dropped []byte
+	buf = NewByteRing(10, WithOverflowFunc(func(d []byte) { dropped = append(dropped, d...) }))
+	buf.WriteString("OlsztynZyje.pl")
+	if want, got := "Olsz", string(dropped); want != got {
+		t.Errorf("WithOverflowFunc want: %q, got: %q", want, got)
+	}
+
+	buf = NewByteRing(10, WithZeroOnReset())
+	buf.WriteString("Olsztyn")
+	buf.WriteTo(io.Discard) // keeps a copy in scratch
+	buf.Reset()
+	if !bytes.Equal(buf.b, make([]byte, 10)) || bytes.ContainsAny(buf.scratch, "Olsztyn") {
+		t.Errorf("WithZeroOnReset left data in memory: %q, %q", buf.b, buf.scratch)
+	}
+	buf.WriteString("Olsztyn")
+	buf.WriteTo(io.Discard)
+	buf.ResetAndResize(5)
+	if !bytes.Equal(buf.b[:cap(buf.b)], make([]byte, 10)) || bytes.ContainsAny(buf.scratch, "Olsztyn") {
+		t.Errorf("ResetAndResize WithZeroOnReset left data in memory: %q, %q", buf.b, buf.scratch)
+	}
+	buf = NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.Reset()
+	if want, got := "Olsztyn", string(buf.b[:7]); want != got {
+		t.Errorf("Reset without WithZeroOnReset want: %q, got: %q", want, got)
+	}
+}
+
+type slowWriter time.Duration
+
+func (s slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(time.Duration(s))
+	return len(p), nil
+}
+
+func BenchmarkWriteDuringSlowWriteTo(b *testing.B) {
+	buf := NewByteRing(1024)
+	d := []byte(benchText)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				buf.WriteTo(slowWriter(time.Millisecond))
+			}
+		}
+	}()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Write(d)
+	}
+	b.StopTimer()
+	close(done)
+}
+
+func BenchmarkReadFrom(b *testing.B) {
+	buf := NewByteRing(1024)
+	d := bytes.Repeat([]byte(benchText), 1<<17)
+	r := bytes.NewReader(d)
+	b.SetBytes(int64(len(d)))
+	for i := 0; i < b.N; i++ {
+		r.Reset(d)
+		buf.ReadFrom(r)
+	}
+}
+
+func BenchmarkReadFromSize(b *testing.B) {
+	d := bytes.Repeat([]byte(benchText), 1<<17)
+	for _, chunk := range []int{64, 256, 1024, 4096, 32 * 1024} {
+		b.Run(strconv.Itoa(chunk), func(b *testing.B) {
+			buf := NewByteRing(1024)
+			r := bytes.NewReader(d)
+			b.SetBytes(int64(len(d)))
+			for i := 0; i < b.N; i++ {
+				r.Reset(d)
+				buf.ReadFromSize(r, chunk)
+			}
+		})
+	}
+}
+
+func TestReadFromSize(t *testing.T) {
+	in := strings.Repeat("0123456789", 100) + "Olsztyn"
+	for _, chunk := range []int{-1, 0, 1, 3, 10, 4096} {
+		buf := NewByteRing(10)
+		n, err := buf.ReadFromSize(iotest.OneByteReader(strings.NewReader(in)), chunk)
+		if err != nil || n != int64(len(in)) {
+			t.Errorf("[%d] ReadFromSize want: %d, nil, got: %d, %v", chunk, len(in), n, err)
+		}
+		if want, got := in[len(in)-10:], string(buf.Bytes()); want != got {
+			t.Errorf("[%d] ReadFromSize want: %q, got: %q", chunk, want, got)
+		}
+	}
+}
+
+func TestReadFromOverflow(t *testing.T) {
+	var dropped []byte
+	buf := NewByteRing(10)
+	buf.OnOverflow(func(d []byte) {
+		dropped = append(dropped, d...)
+		buf.Available() // must not deadlock
+	})
+	in := strings.Repeat("0123456789", 100) + "Olsztyn"
+	buf.ReadFrom(strings.NewReader(in))
+	if want, got := in[:len(in)-10], string(dropped); want != got {
+		t.Errorf("dropped want: %q, got: %q", want, got)
+	}
+}
+
+func TestReadFromDirect(t *testing.T) {
+	var data = []struct {
+		Name string
+		Pre  string
+		Skip int
+		In   string
+		Want string
+	}{
+		{"Fits", "", 0, "Olsztyn", "Olsztyn"},
+		{"Fills", "", 0, "0123456789", "0123456789"},
+		{"Free space wraps", "Olsztyn", 3, "Zyje.p", "ztynZyje.p"},
+		{"Overflows", "Olsztyn", 3, "Zyje.pl!", "ynZyje.pl!"},
+		{"Much bigger", "Olsztyn", 0, strings.Repeat("0123456789", 10) + "Zyje.pl", "789Zyje.pl"},
+	}
+	for i, d := range data {
+		buf := NewByteRing(10)
+		buf.WriteString(d.Pre)
+		buf.Discard(d.Skip)
+		n, err := buf.ReadFromSize(iotest.HalfReader(strings.NewReader(d.In)), 4)
+		if err != nil || n != int64(len(d.In)) {
+			t.Errorf("[%d] %q ReadFromSize want: %d, nil, got: %d, %v", i, d.Name, len(d.In), n, err)
+		}
+		if got := string(buf.Bytes()); d.Want != got {
+			t.Errorf("[%d] %q ReadFromSize want: %q, got: %q", i, d.Name, d.Want, got)
+		}
+		if w, _ := buf.Stats(); int(w) != len(d.Pre)+len(d.In) {
+			t.Errorf("[%d] %q Stats written want: %d, got: %d", i, d.Name, len(d.Pre)+len(d.In), w)
+		}
+	}
+}
+
+func BenchmarkReadFromFreeSpace(b *testing.B) {
+	d := bytes.Repeat([]byte(benchText), 1<<17)
+	buf := NewByteRing(len(d))
+	r := bytes.NewReader(d)
+	b.SetBytes(int64(len(d)))
+	for i := 0; i < b.N; i++ {
+		r.Reset(d)
+		buf.Reset()
+		buf.ReadFrom(r)
+	}
+}
+
+type countingWriter struct {
+	bytes.Buffer
+	writes, buffersWrites int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func (w *countingWriter) WriteBuffers(bufs net.Buffers) (int64, error) {
+	w.buffersWrites++
+	return bufs.WriteTo(&w.Buffer)
+}
+
+func TestWriteToBuffersWriter(t *testing.T) {
+	buf := NewByteRingUnsafe(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl")
+	w := &countingWriter{}
+	if n, err := buf.WriteTo(w); err != nil || n != 10 {
+		t.Errorf("WriteTo want: 10, nil, got: %d, %v", n, err)
+	}
+	if w.writes != 0 || w.buffersWrites != 1 {
+		t.Errorf("WriteTo want a single WriteBuffers call, got: %d Write, %d WriteBuffers", w.writes, w.buffersWrites)
+	}
+	if want, got := "tynZyje.pl", w.String(); want != got {
+		t.Errorf("WriteTo want: %q, got: %q", want, got)
+	}
+
+	buf = NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl")
+	w = &countingWriter{}
+	buf.WriteTo(w)
+	if w.writes+w.buffersWrites != 1 {
+		t.Errorf("WriteTo want a single call, got: %d Write, %d WriteBuffers", w.writes, w.buffersWrites)
+	}
+	if want, got := "tynZyje.pl", w.String(); want != got {
+		t.Errorf("WriteTo want: %q, got: %q", want, got)
+	}
+}
+
+func TestCopyN(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl"
+	var data = []struct {
+		Offset, N int
+		Want      string
+	}{
+		{0, 0, ""},
+		{0, -1, ""},
+		{2, 3, "nZy"},
+		{2, 6, "nZyje."},
+		{2, 10, "nZyje."},
+		{7, 5, ".pl"},
+		{10, 5, ""},
+	}
+	for i, d := range data {
+		dest := make([]byte, 6)
+		n := buf.CopyN(dest, d.Offset, d.N)
+		if d.Want != string(dest[:n]) {
+			t.Errorf("[%d] CopyN(%d, %d) want: %q, got: %q", i, d.Offset, d.N, d.Want, dest[:n])
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, n := range []int{-1, 0, 1, 3, 6, 9, 10, 12} {
+		buf := NewByteRing(10)
+		buf.WriteString("Olsztyn")
+		buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+		buf.Truncate(n)
+		want := "tynZyje.pl"[10-min(max(n, 0), 10):]
+		if got := string(buf.Bytes()); want != got {
+			t.Errorf("Truncate(%d) want: %q, got: %q", n, want, got)
+		}
+		if buf.Available() != len(want) {
+			t.Errorf("Truncate(%d) Available want: %d, got: %d", n, len(want), buf.Available())
+		}
+		b := make([]byte, 2)
+		if k := buf.Tail(b); want[len(want)-k:] != string(b[:k]) {
+			t.Errorf("Truncate(%d) Tail want: %q, got: %q", n, want[len(want)-k:], b[:k])
+		}
+		if k := buf.Copy(b, 0); want[:k] != string(b[:k]) {
+			t.Errorf("Truncate(%d) Copy want: %q, got: %q", n, want[:k], b[:k])
+		}
+		buf.WriteString("!")
+		bbuf := &bytes.Buffer{}
+		buf.WriteTo(bbuf)
+		if want, got := (want + "!")[max(len(want)-9, 0):], bbuf.String(); want != got {
+			t.Errorf("Truncate(%d) WriteTo after write want: %q, got: %q", n, want, got)
+		}
+	}
+}
+
+func TestBlockingRead(t *testing.T) {
+	buf := NewByteRing(10)
+	p := make([]byte, 4)
+	type result struct {
+		d   string
+		err error
+	}
+	results := make(chan result)
+	go func() {
+		for {
+			n, err := buf.BlockingRead(p)
+			results <- result{string(p[:n]), err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case r := <-results:
+		t.Fatalf("BlockingRead returned without data: %q, %v", r.d, r.err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	buf.WriteString("Olsztyn")
+	for _, want := range []string{"Olsz", "tyn"} {
+		if r := <-results; r.err != nil || r.d != want {
+			t.Errorf("BlockingRead want: %q, got: %q, %v", want, r.d, r.err)
+		}
+	}
+	buf.WriteByte('!')
+	if r := <-results; r.err != nil || r.d != "!" {
+		t.Errorf("BlockingRead want: %q, got: %q, %v", "!", r.d, r.err)
+	}
+	buf.Close()
+	if r := <-results; r.err != io.EOF {
+		t.Errorf("BlockingRead after Close want: EOF, got: %q, %v", r.d, r.err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	if err := buf.Close(); err != nil {
+		t.Errorf("Close err: %s", err)
+	}
+	if err := buf.Close(); err != nil {
+		t.Errorf("second Close err: %s", err)
+	}
+	if n, err := buf.Write([]byte("Zyje")); n != 0 || err != ErrClosed {
+		t.Errorf("Write after Close want: 0, %v, got: %d, %v", ErrClosed, n, err)
+	}
+	if n, err := buf.WriteString("Zyje"); n != 0 || err != ErrClosed {
+		t.Errorf("WriteString after Close want: 0, %v, got: %d, %v", ErrClosed, n, err)
+	}
+	if err := buf.WriteByte('Z'); err != ErrClosed {
+		t.Errorf("WriteByte after Close want: %v, got: %v", ErrClosed, err)
+	}
+	if n, err := buf.ReadFrom(strings.NewReader("Zyje")); n != 0 || err != ErrClosed {
+		t.Errorf("ReadFrom after Close want: 0, %v, got: %d, %v", ErrClosed, n, err)
+	}
+	p := make([]byte, 4)
+	for _, want := range []string{"Olsz", "tyn"} {
+		if n, err := buf.BlockingRead(p); err != nil || want != string(p[:n]) {
+			t.Errorf("BlockingRead after Close want: %q, got: %q, %v", want, p[:n], err)
+		}
+	}
+	if n, err := buf.BlockingRead(p); n != 0 || err != io.EOF {
+		t.Errorf("BlockingRead after Close want: 0, EOF, got: %d, %v", n, err)
+	}
+}
+
+func TestLossless(t *testing.T) {
+	buf := NewByteRing(10, WithLossless())
+	if n, err := buf.WriteString("Olsztyn"); n != 7 || err != nil {
+		t.Errorf("WriteString want: 7, nil, got: %d, %v", n, err)
+	}
+	buf.Discard(3)
+	if n, err := buf.Write([]byte("Zyje.pl")); n != 6 || err != io.ErrShortWrite {
+		t.Errorf("Write want: 6, %v, got: %d, %v", io.ErrShortWrite, n, err)
+	}
+	if want, got := "ztynZyje.p", string(buf.Bytes()); want != got {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+	if err := buf.WriteByte('l'); err != io.ErrShortWrite {
+		t.Errorf("WriteByte want: %v, got: %v", io.ErrShortWrite, err)
+	}
+	if n, err := buf.ReadFrom(strings.NewReader("l")); n != 0 || err != io.ErrShortWrite {
+		t.Errorf("ReadFrom want: 0, %v, got: %d, %v", io.ErrShortWrite, n, err)
+	}
+	if _, d := buf.Stats(); d != 0 {
+		t.Errorf("Stats dropped want: 0, got: %d", d)
+	}
+
+	buf.Discard(2)
+	if n, err := buf.ReadFrom(strings.NewReader("l!")); n != 2 || err != io.ErrShortWrite {
+		t.Errorf("ReadFrom want: 2, %v, got: %d, %v", io.ErrShortWrite, n, err)
+	}
+	if err := buf.WriteByte('?'); err != io.ErrShortWrite {
+		t.Errorf("WriteByte want: %v, got: %v", io.ErrShortWrite, err)
+	}
+	if want, got := "ynZyje.pl!", string(buf.Bytes()); want != got {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	buf := NewByteRing(10, WithLossless())
+	p := make([]byte, 4)
+	var ops = []struct {
+		Name string
+		Op   func()
+		Want int
+	}{
+		{"Fresh", func() {}, 10},
+		{"Write 7", func() { buf.WriteString("Olsztyn") }, 3},
+		{"Read 4", func() { buf.Read(p) }, 7},
+		{"Write 7", func() { buf.WriteString("Zyje.pl") }, 0},
+		{"Write over", func() { buf.WriteString("!") }, 0},
+		{"Read 4", func() { buf.Read(p) }, 4},
+		{"Reset", func() { buf.Reset() }, 10},
+	}
+	for i, o := range ops {
+		o.Op()
+		if got := buf.Remaining(); o.Want != got {
+			t.Errorf("[%d] %s Remaining want: %d, got: %d", i, o.Name, o.Want, got)
+		}
+		if buf.Remaining()+buf.Available() != buf.Size() {
+			t.Errorf("[%d] %s Remaining + Available != Size", i, o.Name)
+		}
+	}
+}
+
+func TestDequeue(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	dest := make([]byte, 8)
+	if n := buf.Dequeue(dest); n != 8 || string(dest) != "tynZyje." {
+		t.Errorf("Dequeue want: %q, got: %q", "tynZyje.", dest[:n])
+	}
+	buf.WriteString("!")
+	if n := buf.Dequeue(dest); n != 3 || string(dest[:n]) != "pl!" {
+		t.Errorf("Dequeue want: %q, got: %q", "pl!", dest[:n])
+	}
+	if !buf.IsEmpty() {
+		t.Errorf("buffer is not drained, Available: %d", buf.Available())
+	}
+	if n := buf.Dequeue(dest); n != 0 {
+		t.Errorf("Dequeue on empty buffer want: 0, got: %d", n)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	var dropped []byte
+	buf := NewByteRing(30, WithOverflowFunc(func(d []byte) { dropped = append(dropped, d...) }))
+	for _, r := range []string{"Olsztyn", "", "Zyje"} {
+		if err := buf.WriteRecord([]byte(r)); err != nil {
+			t.Errorf("WriteRecord(%q) err: %s", r, err)
+		}
+	}
+	if r, err := buf.ReadRecord(); err != nil || string(r) != "Olsztyn" {
+		t.Errorf("ReadRecord want: %q, got: %q, %v", "Olsztyn", r, err)
+	}
+	// wraps and drops the empty record
+	for _, r := range []string{"pozytywna", "strona"} {
+		if err := buf.WriteRecord([]byte(r)); err != nil {
+			t.Errorf("WriteRecord(%q) err: %s", r, err)
+		}
+	}
+	if want := "\x00\x00\x00\x00\x00\x00\x00\x04Zyje"; want != string(dropped) {
+		t.Errorf("dropped want: %q, got: %q", want, dropped)
+	}
+	for _, want := range []string{"pozytywna"} {
+		if r, err := buf.ReadRecord(); err != nil || string(r) != want {
+			t.Errorf("ReadRecord want: %q, got: %q, %v", want, r, err)
+		}
+	}
+	if err := buf.WriteRecord([]byte("a")); err != nil {
+		t.Errorf("WriteRecord err: %s", err)
+	}
+	for _, want := range []string{"strona", "a"} {
+		if r, err := buf.ReadRecord(); err != nil || string(r) != want {
+			t.Errorf("ReadRecord want: %q, got: %q, %v", want, r, err)
+		}
+	}
+	if r, err := buf.ReadRecord(); err != io.EOF {
+		t.Errorf("ReadRecord want: EOF, got: %q, %v", r, err)
+	}
+	if err := buf.WriteRecord(make([]byte, 27)); err != ErrRecordTooLarge {
+		t.Errorf("WriteRecord want: %v, got: %v", ErrRecordTooLarge, err)
+	}
+	buf.WriteString("\x00\x00")
+	if r, err := buf.ReadRecord(); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadRecord want: %v, got: %q, %v", io.ErrUnexpectedEOF, r, err)
+	}
+}
+
+func TestRecordDropUnread(t *testing.T) {
+	buf := NewByteRing(16)
+	buf.WriteRecord([]byte("ab"))
+	buf.ReadRecord()
+	buf.WriteRecord([]byte("cdef"))
+	buf.WriteRecord([]byte("ghijk")) // drops "cdef"
+	if err := buf.UnreadByte(); err != ErrInvalidUnreadByte {
+		t.Errorf("UnreadByte want: %v, got: %v", ErrInvalidUnreadByte, err)
+	}
+	if r, err := buf.ReadRecord(); err != nil || string(r) != "ghijk" {
+		t.Errorf("ReadRecord want: %q, got: %q, %v", "ghijk", r, err)
+	}
+}
+
+func TestRecordLossless(t *testing.T) {
+	buf := NewByteRing(20, WithLossless())
+	buf.WriteRecord([]byte("Olsztyn"))
+	if err := buf.WriteRecord([]byte("Zyje.pl!!")); err != io.ErrShortWrite {
+		t.Errorf("WriteRecord want: %v, got: %v", io.ErrShortWrite, err)
+	}
+	if want, got := 11, buf.Available(); want != got {
+		t.Errorf("Available want: %d, got: %d", want, got)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	for i, d := range extensiveData {
+		buf := NewByteRing(d.BufSize)
+		for _, in := range d.In {
+			buf.WriteString(in)
+		}
+		if want, got := crc32.ChecksumIEEE(buf.Bytes()), buf.Checksum(); want != got {
+			t.Errorf("[%d] %q Checksum want: %x, got: %x", i, d.Name, want, got)
+		}
+		if want, got := crc32.ChecksumIEEE([]byte(d.Want)), buf.Checksum(); want != got {
+			t.Errorf("[%d] %q Checksum want: %x, got: %x", i, d.Name, want, got)
+		}
+	}
+}
+
+func TestWriteToHash(t *testing.T) {
+	for i, d := range extensiveData {
+		for _, buf := range []*ByteRing{NewByteRing(d.BufSize), NewByteRingUnsafe(d.BufSize)} {
+			for _, in := range d.In {
+				buf.WriteString(in)
+			}
+			h := sha256.New()
+			if n, err := buf.WriteTo(h); err != nil || n != int64(len(d.Want)) {
+				t.Errorf("[%d] %q WriteTo want: %d, nil, got: %d, %v", i, d.Name, len(d.Want), n, err)
+			}
+			if want, got := sha256.Sum256(buf.Bytes()), h.Sum(nil); !bytes.Equal(want[:], got) {
+				t.Errorf("[%d] %q sha256 want: %x, got: %x", i, d.Name, want, got)
+			}
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	var dropped []byte
+	buf := NewByteRing(10, WithOverflowFunc(func(d []byte) { dropped = append(dropped, d...) }))
+	buf.WriteString("Olsztyn")
+	buf.Discard(2)
+	buf.Fill('x')
+	if want, got := "xxxxxxxxxx", string(buf.Bytes()); want != got {
+		t.Errorf("Fill want: %q, got: %q", want, got)
+	}
+	if want, got := "sztyn", string(dropped); want != got {
+		t.Errorf("Fill dropped want: %q, got: %q", want, got)
+	}
+	if want, got := 10, buf.Available(); want != got || !buf.IsFull() {
+		t.Errorf("Available want: %d, got: %d, IsFull: %v", want, got, buf.IsFull())
+	}
+	buf.WriteString("Ol")
+	if want, got := "xxxxxxxxOl", string(buf.Bytes()); want != got {
+		t.Errorf("Write after Fill want: %q, got: %q", want, got)
+	}
+	buf.Close()
+	buf.Fill('y')
+	if want, got := "xxxxxxxxOl", string(buf.Bytes()); want != got {
+		t.Errorf("Fill after Close want: %q, got: %q", want, got)
+	}
+
+	buf = NewByteRing(4, WithLossless())
+	buf.WriteString("Olsz")
+	buf.Discard(2)
+	buf.Fill('x')
+	if want, got := "szxx", string(buf.Bytes()); want != got {
+		t.Errorf("lossless Fill want: %q, got: %q", want, got)
+	}
+	if _, d := buf.Stats(); d != 0 {
+		t.Errorf("lossless Fill dropped want: 0, got: %d", d)
+	}
+}
+
+func TestWriteRepeat(t *testing.T) {
+	var data = []struct {
+		N    int
+		Want string
+	}{
+		{0, "lsztyn"},
+		{2, "lsztynxx"},
+		{4, "lsztynxxxx"},
+		{5, "sztynxxxxx"},
+		{10, "xxxxxxxxxx"},
+		{12, "xxxxxxxxxx"},
+	}
+	for i, d := range data {
+		var dropped []byte
+		buf := NewByteRing(10, WithOverflowFunc(func(d []byte) { dropped = append(dropped, d...) }))
+		buf.WriteString("Olsztyn")
+		buf.Discard(1)
+		if n, err := buf.WriteRepeat('x', d.N); n != d.N || err != nil {
+			t.Errorf("[%d] WriteRepeat(%d) want: %d, nil, got: %d, %v", i, d.N, d.N, n, err)
+		}
+		if got := string(buf.Bytes()); d.Want != got {
+			t.Errorf("[%d] WriteRepeat(%d) want: %q, got: %q", i, d.N, d.Want, got)
+		}
+		want := ("lsztyn" + strings.Repeat("x", d.N))[:max(d.N-4, 0)]
+		if want != string(dropped) {
+			t.Errorf("[%d] WriteRepeat(%d) dropped want: %q, got: %q", i, d.N, want, dropped)
+		}
+		if w, _ := buf.Stats(); int(w) != 7+d.N {
+			t.Errorf("[%d] WriteRepeat(%d) written want: %d, got: %d", i, d.N, 7+d.N, w)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.Discard(2)
+	s := buf.Snapshot()
+	buf.WriteString("Zyj")
+	buf.ReadByte()
+	if err := buf.Restore(s); err != nil {
+		t.Errorf("Restore err: %s", err)
+	}
+	if want, got := "sztyn", string(buf.Bytes()); want != got {
+		t.Errorf("Restore want: %q, got: %q", want, got)
+	}
+	if err := buf.UnreadByte(); err != nil {
+		t.Errorf("UnreadByte after Restore err: %s", err)
+	}
+	if err := buf.Restore(s); err != ErrStateLost {
+		t.Errorf("second Restore want: %v, got: %v", ErrStateLost, err)
+	}
+
+	s = buf.Snapshot()
+	buf.WriteString("Zyje") // exactly fills free space
+	if err := buf.Restore(s); err != nil {
+		t.Errorf("Restore err: %s", err)
+	}
+	if want, got := "lsztyn", string(buf.Bytes()); want != got {
+		t.Errorf("Restore want: %q, got: %q", want, got)
+	}
+
+	s = buf.Snapshot()
+	buf.WriteString("Zyje.pl") // overwrites the beginning
+	if err := buf.Restore(s); err != ErrStateLost {
+		t.Errorf("Restore after overwrite want: %v, got: %v", ErrStateLost, err)
+	}
+	if want, got := "tynZyje.pl", string(buf.Bytes()); want != got {
+		t.Errorf("failed Restore must not change data, want: %q, got: %q", want, got)
+	}
+
+	s = buf.Snapshot()
+	buf.Reset()
+	if err := buf.Restore(s); err != ErrStateLost {
+		t.Errorf("Restore after Reset want: %v, got: %v", ErrStateLost, err)
+	}
+}
+
+func TestWriteToRange(t *testing.T) {
+	var data = []struct {
+		Offset, N int
+		Want      string
+	}{
+		{0, 0, ""},
+		{0, 10, "tynZyje.pl"},
+		{2, 3, "nZy"},
+		{4, 4, "yje."},
+		{6, 2, "e."}, // second interval only
+		{7, 3, ".pl"},
+		{5, 20, "je.pl"},
+		{10, 5, ""},
+		{12, 5, ""},
+	}
+	for _, unsafe := range []bool{false, true} {
+		buf := NewByteRing(10)
+		if unsafe {
+			buf = NewByteRingUnsafe(10)
+		}
+		buf.WriteString("Olsztyn")
+		buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+		for i, d := range data {
+			var bbuf bytes.Buffer
+			n, err := buf.WriteToRange(&bbuf, d.Offset, d.N)
+			if err != nil {
+				t.Errorf("[%d] WriteToRange(%d, %d) err: %s", i, d.Offset, d.N, err)
+			}
+			if d.Want != bbuf.String() || n != len(d.Want) {
+				t.Errorf("[%d] WriteToRange(%d, %d) unsafe=%v want: %q, got: %q (%d)", i, d.Offset, d.N, unsafe, d.Want, bbuf.String(), n)
+			}
+		}
+		if _, err := buf.WriteToRange(io.Discard, -1, 1); err != errNegativeOffset {
+			t.Errorf("negative offset want: %v, got: %v", errNegativeOffset, err)
+		}
+		if _, err := buf.WriteToRange(io.Discard, 0, -1); err != errNegativeSize {
+			t.Errorf("negative size want: %v, got: %v", errNegativeSize, err)
+		}
+		if want, got := "tynZyje.pl", buf.String(); want != got {
+			t.Errorf("WriteToRange must not consume data, want: %q, got: %q", want, got)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	var data = []struct {
+		Offset, N int
+	}{
+		{0, 0},
+		{2, 4},
+		{4, 4},
+		{0, 10},
+		{7, 6},
+		{10, 1},
+		{-1, 3},
+	}
+	for i, d := range data {
+		got, err := io.ReadAll(buf.Reader(d.Offset, d.N))
+		if err != nil {
+			t.Errorf("[%d] Reader(%d, %d) err: %s", i, d.Offset, d.N, err)
+		}
+		want := make([]byte, max(d.N, 0))
+		want = want[:buf.Copy(want, max(d.Offset, 0))]
+		if d.Offset < 0 {
+			want = want[:0]
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf("[%d] Reader(%d, %d) want: %q, got: %q", i, d.Offset, d.N, want, got)
+		}
+	}
+
+	r := buf.Reader(2, 4)
+	buf.WriteString("Olsztyn")
+	if got, _ := io.ReadAll(r); string(got) != "nZyj" {
+		t.Errorf("Reader after write want: %q, got: %q", "nZyj", got)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	var data = []struct {
+		Writes []string
+		Read   int
+		Want   string
+	}{
+		{nil, 0, ""},
+		{[]string{"Olsztyn"}, 0, "Olsztyn"},
+		{[]string{"Olsztyn"}, 3, "ztyn"},
+		{[]string{"Olsztyn", "Zyj"}, 0, "OlsztynZyj"},
+		{[]string{"Olsztyn", "Zyje.pl"}, 0, "tynZyje.pl"},
+		{[]string{"Olsztyn", "Zyje.pl"}, 4, "yje.pl"},
+		{[]string{"Olsztyn", "Zyje.pl"}, 10, ""},
+	}
+	for i, d := range data {
+		buf := NewByteRing(10)
+		for _, w := range d.Writes {
+			buf.WriteString(w)
+		}
+		buf.Discard(d.Read)
+		buf.Compact()
+		if got := buf.String(); d.Want != got {
+			t.Errorf("[%d] Compact want: %q, got: %q", i, d.Want, got)
+		}
+		if got := string(buf.b[:buf.Available()]); d.Want != got {
+			t.Errorf("[%d] Compact underlying want: %q, got: %q", i, d.Want, got)
+		}
+		buf.WriteString("ab")
+		if want, got := d.Want+"ab", buf.String(); want[max(len(want)-10, 0):] != got {
+			t.Errorf("[%d] write after Compact want: %q, got: %q", i, want, got)
+		}
+	}
+
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.ReadByte()
+	buf.Compact()
+	if err := buf.UnreadByte(); err != nil {
+		t.Errorf("UnreadByte after Compact err: %s", err)
+	}
+	if want, got := "Olsztyn", buf.String(); want != got {
+		t.Errorf("UnreadByte after Compact want: %q, got: %q", want, got)
+	}
+}
+
+func TestLenCap(t *testing.T) {
+	buf := NewByteRing(10)
+	for i, w := range []string{"", "Ol", "sztyn", "Zyje.pl", "Olsztyn"} {
+		buf.WriteString(w)
+		if i == 3 {
+			buf.Discard(4)
+		}
+		if buf.Len() != buf.Available() {
+			t.Errorf("[%d] Len want: %d, got: %d", i, buf.Available(), buf.Len())
+		}
+		if buf.Cap() != buf.Size() {
+			t.Errorf("[%d] Cap want: %d, got: %d", i, buf.Size(), buf.Cap())
+		}
+	}
+}
+
+func TestWriteAt(t *testing.T) {
+	var data = []struct {
+		Patch  string
+		Offset int64
+		Want   string
+		Err    error
+	}{
+		{"", 0, "tynZyje.pl", nil},
+		{"T", 0, "TynZyje.pl", nil},
+		{"ZYJ", 3, "tynZYJe.pl", nil},
+		{"J.PL", 5, "tynZyJ.PLl", nil}, // across the wrap boundary
+		{".P", 7, "tynZyje.Pl", nil},   // second interval only
+		{"PL", 8, "tynZyje.PL", nil},
+		{"PL!", 8, "tynZyje.pl", errOutOfRange},
+		{"", 11, "tynZyje.pl", errOutOfRange},
+		{"X", math.MaxInt64, "tynZyje.pl", errOutOfRange},
+		{"t", -1, "tynZyje.pl", errNegativeOffset},
+	}
+	for i, d := range data {
+		buf := NewByteRing(10)
+		buf.WriteString("Olsztyn")
+		buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+		n, err := buf.WriteAt([]byte(d.Patch), d.Offset)
+		if err != d.Err {
+			t.Errorf("[%d] WriteAt(%q, %d) err want: %v, got: %v", i, d.Patch, d.Offset, d.Err, err)
+		}
+		if err == nil && n != len(d.Patch) {
+			t.Errorf("[%d] WriteAt(%q, %d) n want: %d, got: %d", i, d.Patch, d.Offset, len(d.Patch), n)
+		}
+		got := make([]byte, 10)
+		got = got[:buf.Copy(got, 0)]
+		if d.Want != string(got) {
+			t.Errorf("[%d] WriteAt(%q, %d) want: %q, got: %q", i, d.Patch, d.Offset, d.Want, got)
+		}
+	}
+}
+
+type countingObserver struct {
+	buf                     *ByteRing
+	written, dropped, wraps int
+	calls                   int
+}
+
+func (o *countingObserver) BytesWritten(n int) {
+	o.written += n
+	o.calls++
+	o.buf.Available() // must not deadlock
+}
+
+func (o *countingObserver) BytesDropped(n int) {
+	o.dropped += n
+	o.calls++
+}
+
+func (o *countingObserver) Wrapped() {
+	o.wraps++
+	o.calls++
+}
+
+func TestObserver(t *testing.T) {
+	obs := &countingObserver{}
+	buf := NewByteRing(10, WithObserver(obs))
+	obs.buf = buf
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyj") // reaches the end of slice
+	buf.WriteString("e.pl")
+	buf.WriteByte('!')
+	buf.WriteRepeat('x', 25)
+	buf.Read(make([]byte, 4))
+	if obs.written != 40 || obs.dropped != 30 || obs.wraps != 2 {
+		t.Errorf("want: 40 written, 30 dropped, 2 wraps, got: %d, %d, %d", obs.written, obs.dropped, obs.wraps)
+	}
+	if obs.calls != 10 {
+		t.Errorf("calls want: %d, got: %d", 10, obs.calls)
+	}
+	if w, d := buf.Stats(); int(w) != obs.written || int(d) != obs.dropped {
+		t.Errorf("Stats want: %d, %d, got: %d, %d", obs.written, obs.dropped, w, d)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	buf := NewByteRing(64)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := make([]byte, 48)
+			for j := range 500 {
+				switch (i + j) % 6 {
+				case 0:
+					buf.Write(d[:j%len(d)])
+				case 1:
+					buf.WriteTo(io.Discard)
+				case 2:
+					buf.Tail(d)
+				case 3:
+					buf.Copy(d, j%80)
+				case 4:
+					buf.Read(d[:j%8])
+				case 5:
+					buf.Grow(64 + j/100)
+				}
+				if n, size := buf.Available(), buf.Size(); n < 0 || n > size {
+					t.Errorf("Available() want: [0, %d], got: %d", size, n)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkAvailableDuringWrites(b *testing.B) {
+	buf := NewByteRing(1024)
+	d := []byte(benchText)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				buf.Write(d)
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if n := buf.Available(); n < 0 || n > buf.Size() {
+				b.Errorf("Available() want: [0, %d], got: %d", buf.Size(), n)
+			}
+		}
+	})
+	b.StopTimer()
+	close(done)
+}
+
+func TestResetKeepsSlice(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	p := &buf.b[0]
+	buf.Reset()
+	if &buf.b[0] != p {
+		t.Errorf("Reset reallocated the underlying slice")
+	}
+	if n := testing.AllocsPerRun(100, func() {
+		buf.WriteString("Olsztyn")
+		buf.Reset()
+	}); n != 0 {
+		t.Errorf("Reset allocs want: 0, got: %v", n)
+	}
+}
+
+func TestResetAndResize(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	p := &buf.b[0]
+	for _, size := range []int{4, 10, 0, 7} {
+		if err := buf.ResetAndResize(size); err != nil {
+			t.Errorf("ResetAndResize(%d) err: %s", size, err)
+		}
+		if buf.Size() != size || buf.Available() != 0 {
+			t.Errorf("ResetAndResize(%d) want size: %d, available: 0, got: %d, %d", size, size, buf.Size(), buf.Available())
+		}
+		if cap(buf.b) > 0 && &buf.b[:1][0] != p {
+			t.Errorf("ResetAndResize(%d) reallocated the underlying slice", size)
+		}
+		buf.WriteString("Zyje.pl")
+		if want, got := "Zyje.pl"[7-min(size, 7):], buf.String(); want != got {
+			t.Errorf("ResetAndResize(%d) write want: %q, got: %q", size, want, got)
+		}
+	}
+	buf.ResetAndResize(12)
+	buf.WriteString("OlsztynZyje.pl")
+	if want, got := "sztynZyje.pl", buf.String(); buf.Size() != 12 || want != got {
+		t.Errorf("ResetAndResize(12) want: %q, got: %q", want, got)
+	}
+	if err := buf.ResetAndResize(-1); err != errNegativeSize {
+		t.Errorf("ResetAndResize(-1) want: %v, got: %v", errNegativeSize, err)
+	}
+}
+
+func BenchmarkPool(b *testing.B) {
+	pool := sync.Pool{New: func() any { return NewByteRing(1024) }}
+	d := []byte(benchText)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := pool.Get().(*ByteRing)
+		buf.Write(d)
+		buf.WriteTo(io.Discard)
+		buf.Reset()
+		pool.Put(buf)
+	}
+}
+
+func TestReadContext(t *testing.T) {
+	buf := NewByteRing(10)
+	p := make([]byte, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if n, err := buf.ReadContext(ctx, p); n != 0 || err != context.DeadlineExceeded {
+		t.Errorf("ReadContext want: 0, %v, got: %d, %v", context.DeadlineExceeded, n, err)
+	}
+
+	buf.WriteString("Olsztyn")
+	if n, err := buf.ReadContext(ctx, p); err != nil || string(p[:n]) != "Olsz" {
+		t.Errorf("ReadContext with data want: %q, got: %q, %v", "Olsz", p[:n], err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	buf.Discard(3)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		buf.WriteString("Zyje")
+	}()
+	if n, err := buf.ReadContext(ctx, p); err != nil || string(p[:n]) != "Zyje" {
+		t.Errorf("ReadContext want: %q, got: %q, %v", "Zyje", p[:n], err)
+	}
+}
+
+func TestWriteContext(t *testing.T) {
+	buf := NewByteRing(10, WithLossless())
+	buf.WriteString("Olsztyn")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if n, err := buf.WriteContext(ctx, []byte("Zyje.pl")); n != 3 || err != context.DeadlineExceeded {
+		t.Errorf("WriteContext want: 3, %v, got: %d, %v", context.DeadlineExceeded, n, err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		buf.Discard(7)
+	}()
+	if n, err := buf.WriteContext(context.Background(), []byte("e.pl")); n != 4 || err != nil {
+		t.Errorf("WriteContext want: 4, nil, got: %d, %v", n, err)
+	}
+	if want, got := "Zyje.pl", buf.String(); want != got {
+		t.Errorf("WriteContext want: %q, got: %q", want, got)
+	}
+}
+
+func TestPeekAt(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	var data = []struct {
+		Offset, N int
+	}{
+		{0, 3},
+		{2, 4},
+		{5, 3},
+		{6, 4},
+		{0, 10},
+		{8, 5},
+		{10, 1},
+		{12, 1},
+		{3, 0},
+		{-1, 2},
+	}
+	for i, d := range data {
+		got := buf.PeekAt(d.Offset, d.N)
+		want := make([]byte, max(d.N, 0))
+		if d.Offset >= 0 {
+			want = want[:buf.Copy(want, d.Offset)]
+		} else {
+			want = want[:0]
+		}
+		if got == nil || !bytes.Equal(want, got) {
+			t.Errorf("[%d] PeekAt(%d, %d) want: %q, got: %q", i, d.Offset, d.N, want, got)
+		}
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	buf := NewByteRing(10)
+	var data = []struct {
+		Write string
+		Bump  bool
+	}{
+		{"Olsz", false},
+		{"tyn", false},
+		{"Zyj", false}, // exactly fills buffer
+		{"e", true},
+		{"", false},
+		{".pl", true},
+	}
+	gen := buf.Generation()
+	for i, d := range data {
+		buf.WriteString(d.Write)
+		if got := buf.Generation(); (got != gen) != d.Bump {
+			t.Errorf("[%d] WriteString(%q) Generation changed want: %v, got: %v", i, d.Write, d.Bump, got != gen)
+		}
+		gen = buf.Generation()
+	}
+	buf.Discard(5)
+	buf.WriteString("Olsz")
+	if buf.Generation() != gen {
+		t.Errorf("write into space freed by read changed Generation")
+	}
+	buf.Reset()
+	if buf.Generation() == gen {
+		t.Errorf("Reset didn't change Generation")
+	}
+	gen = buf.Generation()
+	s := buf.Snapshot()
+	buf.WriteString("Olsz")
+	buf.Restore(s)
+	if buf.Generation() == gen {
+		t.Errorf("Restore didn't change Generation")
+	}
+}
+
+var _ io.WriterTo = (*ByteRing)(nil)
+
+func TestCopyUsesWriteTo(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl")
+	var w strings.Builder // doesn't implement io.ReaderFrom
+	if n, err := io.Copy(&w, buf); err != nil || n != 10 {
+		t.Errorf("io.Copy want: 10, nil, got: %d, %v", n, err)
+	}
+	if want, got := "tynZyje.pl", w.String(); want != got {
+		t.Errorf("io.Copy want: %q, got: %q", want, got)
+	}
+	// Read would consume data, WriteTo doesn't
+	if want, got := "tynZyje.pl", buf.String(); want != got {
+		t.Errorf("io.Copy didn't use WriteTo, want: %q, got: %q", want, got)
+	}
+}
+
+var _ io.ReaderFrom = (*ByteRing)(nil)
+
+var _ io.ReadWriteCloser = (*ByteRing)(nil)
+
+func TestReadWriteCloser(t *testing.T) {
+	var rwc io.ReadWriteCloser = NewByteRing(16)
+	io.WriteString(rwc, "Olsztyn")
+	p := make([]byte, 3)
+	if n, err := rwc.Read(p); err != nil || string(p[:n]) != "Ols" {
+		t.Errorf("Read want: %q, nil, got: %q, %v", "Ols", p[:n], err)
+	}
+	io.WriteString(rwc, "Zyje.pl")
+	if err := rwc.Close(); err != nil {
+		t.Errorf("Close want: nil, got: %v", err)
+	}
+	if _, err := io.WriteString(rwc, "!"); err != ErrClosed {
+		t.Errorf("Write after Close want: %v, got: %v", ErrClosed, err)
+	}
+	d, err := io.ReadAll(rwc)
+	if want, got := "ztynZyje.pl", string(d); err != nil || want != got {
+		t.Errorf("ReadAll after Close want: %q, nil, got: %q, %v", want, got, err)
+	}
+	if n, err := rwc.Read(p); n != 0 || err != io.EOF {
+		t.Errorf("Read of drained want: 0, EOF, got: %d, %v", n, err)
+	}
+}
+
+func TestCopyUsesReadFrom(t *testing.T) {
+	buf := NewByteRing(10)
+	in := strings.Repeat("0123456789", 100) + "OlsztynZyje.pl"
+	// hide strings.Reader's WriteTo, so io.Copy has to choose ReadFrom
+	n, err := io.Copy(buf, struct{ io.Reader }{strings.NewReader(in)})
+	if err != nil || n != int64(len(in)) {
+		t.Errorf("io.Copy want: %d, nil, got: %d, %v", len(in), n, err)
+	}
+	if want, got := "tynZyje.pl", buf.String(); want != got {
+		t.Errorf("io.Copy want: %q, got: %q", want, got)
+	}
+
+	buf.Reset()
+	if _, err := io.Copy(buf, strings.NewReader(in)); err != nil {
+		t.Errorf("io.Copy err: %s", err)
+	}
+	if want, got := "tynZyje.pl", buf.String(); want != got {
+		t.Errorf("io.Copy from strings.Reader want: %q, got: %q", want, got)
+	}
+}
+
+func TestTryWrite(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithLossless()}} {
+		buf := NewByteRing(10, opts...)
+		buf.WriteString("Olsztyn")
+		var data = []struct {
+			In   string
+			N    int
+			OK   bool
+			Want string
+		}{
+			{"Zy", 2, true, "OlsztynZy"},
+			{"je.pl", 1, false, "OlsztynZyj"},
+			{"e", 0, false, "OlsztynZyj"},
+			{"", 0, true, "OlsztynZyj"},
+		}
+		for i, d := range data {
+			n, ok := buf.TryWrite([]byte(d.In))
+			if n != d.N || ok != d.OK {
+				t.Errorf("[%d] TryWrite(%q) want: %d, %v, got: %d, %v", i, d.In, d.N, d.OK, n, ok)
+			}
+			if got := buf.String(); d.Want != got {
+				t.Errorf("[%d] TryWrite(%q) want: %q, got: %q", i, d.In, d.Want, got)
+			}
+		}
+		buf.Close()
+		buf.Discard(3)
+		if n, ok := buf.TryWrite([]byte("e")); n != 0 || ok {
+			t.Errorf("TryWrite after Close want: 0, false, got: %d, %v", n, ok)
+		}
+	}
+}
+
+func TestPeekView(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithoutLocking()}} {
+		buf := NewByteRing(10, opts...)
+		buf.WriteString("Olsztyn")
+		buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+		for _, n := range []int{-1, 0, 3, 4, 5, 10, 12} {
+			want := buf.Peek(n)
+			first, second, release := buf.PeekView(n)
+			got := append(append([]byte{}, first...), second...)
+			release()
+			if !bytes.Equal(want, got) {
+				t.Errorf("%v PeekView(%d) want: %q, got: %q", opts, n, want, got)
+			}
+		}
+		first, _, release := buf.PeekView(2)
+		if &first[0] != &buf.b[2] {
+			t.Errorf("%v PeekView copied data", opts)
+		}
+		release()
+	}
+
+	// a concurrent writer waits for release
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	first, second, release := buf.PeekView(4)
+	done := make(chan struct{})
+	go func() {
+		buf.WriteString("Zyje.pl")
+		close(done)
+	}()
+	time.Sleep(time.Millisecond)
+	if want, got := "ztyn", string(first)+string(second); want != got {
+		t.Errorf("PeekView during write want: %q, got: %q", want, got)
+	}
+	release()
+	<-done
+}
+
+func TestBatchWriter(t *testing.T) {
+	buf := NewByteRing(10)
+	w := buf.Batch()
+	w.WriteString("Olsz")
+	w.Write([]byte("tyn"))
+	if buf.Available() != 0 || w.Buffered() != 7 {
+		t.Errorf("batch written before Flush, Available: %d, Buffered: %d", buf.Available(), w.Buffered())
+	}
+	w.WriteString("Zyje") // doesn't fit, "Olsztyn" is flushed
+	if want, got := "Olsztyn", buf.String(); want != got {
+		t.Errorf("full batch want: %q, got: %q", want, got)
+	}
+	w.WriteByte('.')
+	if err := w.Flush(); err != nil {
+		t.Errorf("Flush err: %s", err)
+	}
+	if want, got := "sztynZyje.", buf.String(); want != got || w.Buffered() != 0 {
+		t.Errorf("Flush want: %q, got: %q", want, got)
+	}
+	w.WriteString("OlsztynZyje.pl") // larger than batch, written directly
+	if want, got := "tynZyje.pl", buf.String(); want != got {
+		t.Errorf("large write want: %q, got: %q", want, got)
+	}
+
+	buf = NewByteRing(10, WithLossless())
+	w = buf.Batch()
+	w.WriteString("Olsztyn")
+	buf.WriteString("Zyje")
+	if err := w.Flush(); err != io.ErrShortWrite || w.Buffered() != 1 {
+		t.Errorf("lossless Flush want: %v, 1 buffered, got: %v, %d", io.ErrShortWrite, err, w.Buffered())
+	}
+	buf.Discard(4)
+	if err := w.Flush(); err != nil || buf.String() != "ZyjeOlsztyn"[4:] {
+		t.Errorf("second Flush want: %q, got: %q, %v", "ZyjeOlsztyn"[4:], buf.String(), err)
+	}
+}
+
+func BenchmarkTinyWrites(b *testing.B) {
+	d := []byte("tiny")
+	b.Run("Write", func(b *testing.B) {
+		buf := NewByteRing(1024)
+		for i := 0; i < b.N; i++ {
+			for range 10000 {
+				buf.Write(d)
+			}
+		}
+	})
+	b.Run("Batch", func(b *testing.B) {
+		buf := NewByteRing(1024)
+		w := buf.Batch()
+		for i := 0; i < b.N; i++ {
+			for range 10000 {
+				w.Write(d)
+			}
+			w.Flush()
+		}
+	})
+}
+
+func TestWriteVec(t *testing.T) {
+	var data = []struct {
+		Pre string
+		Vec []string
+	}{
+		{"", nil},
+		{"", []string{"Ol", "", "sztyn"}},
+		{"Olsztyn", []string{"Z", "yj"}},
+		{"Olsztyn", []string{"Zy", "je", ".pl"}},
+		{"Olsz", []string{"tyn", "Zyje.pl", "!"}},
+		{"", []string{"Olsztyn", "Zyje.pl", ""}},
+		{"Ol", []string{"", "sztynZyje.pl"}},
+	}
+	for i, d := range data {
+		var vec [][]byte
+		for _, s := range d.Vec {
+			vec = append(vec, []byte(s))
+		}
+		joined := []byte(strings.Join(d.Vec, ""))
+		for _, opts := range [][]Option{nil, {WithLossless()}} {
+			var gotDropped, wantDropped []byte
+			got := NewByteRing(10, append(opts, WithOverflowFunc(func(p []byte) { gotDropped = p }))...)
+			want := NewByteRing(10, append(opts, WithOverflowFunc(func(p []byte) { wantDropped = p }))...)
+			got.WriteString(d.Pre)
+			want.WriteString(d.Pre)
+			gotN, gotErr := got.WriteVec(vec...)
+			wantN, wantErr := want.Write(joined)
+			if gotN != wantN || gotErr != wantErr {
+				t.Errorf("[%d] WriteVec want: %d, %v, got: %d, %v", i, wantN, wantErr, gotN, gotErr)
+			}
+			if !got.Equal(want) || !bytes.Equal(gotDropped, wantDropped) {
+				t.Errorf("[%d] WriteVec want: %q, dropped %q, got: %q, dropped %q", i, want, wantDropped, got, gotDropped)
+			}
+			gw, gd := got.Stats()
+			ww, wd := want.Stats()
+			if gw != ww || gd != wd {
+				t.Errorf("[%d] WriteVec Stats want: %d, %d, got: %d, %d", i, ww, wd, gw, gd)
+			}
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	for _, size := range []int{1, 3, 4, 10, 16} {
+		buf := NewByteRing(10)
+		buf.WriteString("Olsztyn")
+		buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+		chunk := make([]byte, size)
+		var got []string
+		left := 10
+		for {
+			n, rest := buf.Drain(chunk)
+			got = append(got, string(chunk[:n]))
+			if left -= n; rest != left {
+				t.Errorf("Drain by %d remaining want: %d, got: %d", size, left, rest)
+			}
+			if rest == 0 {
+				break
+			}
+		}
+		if want := "tynZyje.pl"; strings.Join(got, "") != want || len(got) != (10+size-1)/size {
+			t.Errorf("Drain by %d want: %q, got: %q", size, want, got)
+		}
+		if n, rest := buf.Drain(chunk); n != 0 || rest != 0 {
+			t.Errorf("Drain of empty buffer want: 0, 0, got: %d, %d", n, rest)
+		}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	buf := NewByteRing(12)
+	buf.WriteString("Olsztyn")
+	buf.WriteString(" foo bar baz") // physically "bar bazo foo ", wrapped
+	s := NewScanner(buf)
+	s.Split(bufio.ScanWords)
+	var got []string
+	for s.Scan() {
+		got = append(got, s.Text())
+	}
+	if want := []string{"foo", "bar", "baz"}; fmt.Sprint(want) != fmt.Sprint(got) || s.Err() != nil {
+		t.Errorf("Scan words want: %q, got: %q, %v", want, got, s.Err())
+	}
+	if want, got := " foo bar baz", buf.String(); want != got {
+		t.Errorf("Scan must not consume data, want: %q, got: %q", want, got)
+	}
+
+	buf.WriteString("\nab\n\ncd")
+	s = NewScanner(buf)
+	got = got[:0]
+	for s.Scan() {
+		got = append(got, string(s.Bytes()))
+	}
+	if want := []string{"r baz", "ab", "", "cd"}; fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("Scan lines want: %q, got: %q", want, got)
+	}
+
+	errBoom := errors.New("boom")
+	s = NewScanner(buf)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		return 0, nil, errBoom
+	})
+	if s.Scan() || s.Err() != errBoom {
+		t.Errorf("Scan want: false, %v, got: true or %v", errBoom, s.Err())
+	}
+}
+
+func TestAppendTo(t *testing.T) {
+	for i, d := range extensiveData {
+		buf := NewByteRing(d.BufSize)
+		for _, in := range d.In {
+			buf.WriteString(in)
+		}
+		pre := make([]byte, 3, 64)
+		copy(pre, "pre")
+		got := buf.AppendTo(pre)
+		if want := "pre" + d.Want; want != string(got) {
+			t.Errorf("[%d] %q AppendTo want: %q, got: %q", i, d.Name, want, got)
+		}
+		if len(got) <= cap(pre) && &got[0] != &pre[0] {
+			t.Errorf("[%d] %q AppendTo didn't reuse dst", i, d.Name)
+		}
+	}
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	if got := buf.AppendTo(nil); string(got) != "Olsztyn" {
+		t.Errorf("AppendTo(nil) want: %q, got: %q", "Olsztyn", got)
+	}
+}
+
+func TestLastIndexByte(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	var data = []struct {
+		C    byte
+		Want int
+	}{
+		{'t', 0},
+		{'y', 4},
+		{'j', 5},
+		{'e', 6},
+		{'l', 9},
+		{'O', -1},
+	}
+	for i, d := range data {
+		if got := buf.LastIndexByte(d.C); d.Want != got {
+			t.Errorf("[%d] LastIndexByte(%q) want: %d, got: %d", i, d.C, d.Want, got)
+		}
+	}
+	buf.WriteString("yy") // "nZyje.plyy"
+	if want, got := 9, buf.LastIndexByte('y'); want != got {
+		t.Errorf("LastIndexByte('y') want: %d, got: %d", want, got)
+	}
+}
+
+func TestCountByte(t *testing.T) {
+	buf := NewByteRing(16)
+	buf.WriteString("first\nsecond\n")
+	buf.WriteString("third\nfour") // "econd\nthird\nfour", wrapped
+	var data = []struct {
+		C    byte
+		Want int
+	}{
+		{'\n', 2},
+		{'d', 2},
+		{'r', 2},
+		{'x', 0},
+	}
+	for i, d := range data {
+		if got := buf.CountByte(d.C); d.Want != got {
+			t.Errorf("[%d] CountByte(%q) in %q want: %d, got: %d", i, d.C, buf.String(), d.Want, got)
+		}
+	}
+}
+
+func TestSeekRead(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	p := make([]byte, 5)
+	buf.Read(p)
+	if want, got := 5, buf.ReadPos(); want != got {
+		t.Errorf("ReadPos want: %d, got: %d", want, got)
+	}
+	if err := buf.SeekRead(1); err != nil {
+		t.Errorf("SeekRead(1) err: %s", err)
+	}
+	if want, got := "lsztyn", buf.String(); want != got || buf.ReadPos() != 1 {
+		t.Errorf("SeekRead(1) want: %q, 1, got: %q, %d", want, got, buf.ReadPos())
+	}
+	if err := buf.SeekRead(4); err != nil {
+		t.Errorf("SeekRead(4) err: %s", err)
+	}
+	if want, got := "tyn", buf.String(); want != got {
+		t.Errorf("SeekRead(4) want: %q, got: %q", want, got)
+	}
+	for _, off := range []int{-1, 8} {
+		if err := buf.SeekRead(off); err != errOutOfRange {
+			t.Errorf("SeekRead(%d) want: %v, got: %v", off, errOutOfRange, err)
+		}
+	}
+
+	buf.WriteString("Zyje.p") // "Ols" overwritten, read "z" still intact
+	if want, got := 1, buf.ReadPos(); want != got {
+		t.Errorf("ReadPos after overwrite want: %d, got: %d", want, got)
+	}
+	if err := buf.SeekRead(0); err != nil {
+		t.Errorf("SeekRead(0) err: %s", err)
+	}
+	if want, got := "ztynZyje.p", buf.String(); want != got || !buf.IsFull() {
+		t.Errorf("SeekRead(0) want: %q, full, got: %q, %v", want, got, buf.IsFull())
+	}
+	if err := buf.SeekRead(10); err != nil || buf.Available() != 0 {
+		t.Errorf("SeekRead(10) want: nil, empty, got: %v, %d", err, buf.Available())
+	}
+}
+
+type onceWriter struct {
+	bytes.Buffer
+	calls int
+}
+
+func (w *onceWriter) Write(p []byte) (int, error) {
+	if w.calls++; w.calls > 1 {
+		return 0, errors.New("Write called more than once")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestWriteToContiguous(t *testing.T) {
+	for _, buf := range []*ByteRing{NewByteRing(10), NewByteRingUnsafe(10)} {
+		buf.WriteString("Olsztyn")
+		buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+		w := &onceWriter{}
+		if n, err := buf.WriteToContiguous(w); err != nil || n != 10 {
+			t.Errorf("WriteToContiguous want: 10, nil, got: %d, %v", n, err)
+		}
+		if want, got := "tynZyje.pl", w.String(); want != got {
+			t.Errorf("WriteToContiguous want: %q, got: %q", want, got)
+		}
+		if n := testing.AllocsPerRun(10, func() { buf.WriteToContiguous(io.Discard) }); n != 0 {
+			t.Errorf("WriteToContiguous allocs want: 0, got: %v", n)
+		}
+	}
+}
+
+func TestAutoGrow(t *testing.T) {
+	buf := NewByteRing(4, WithAutoGrow(20))
+	var data = []struct {
+		In   string
+		Size int
+		Want string
+	}{
+		{"Olsz", 4, "Olsz"},
+		{"t", 8, "Olszt"},
+		{"yn", 8, "Olsztyn"},
+		{"Zyje.pl", 16, "OlsztynZyje.pl"},
+		{"Olsztyn", 20, "OlsztynZyje.plOlsztyn"[1:]},
+		{"!", 20, "lsztynZyje.plOlsztyn!"[1:]},
+	}
+	for i, d := range data {
+		buf.WriteString(d.In)
+		if got := buf.String(); d.Want != got || d.Size != buf.Size() {
+			t.Errorf("[%d] WriteString(%q) want: %q, size %d, got: %q, size %d", i, d.In, d.Want, d.Size, got, buf.Size())
+		}
+	}
+	if w, dropped := buf.Stats(); w != 22 || dropped != 2 {
+		t.Errorf("Stats want: 22, 2, got: %d, %d", w, dropped)
+	}
+
+	buf = NewByteRing(0, WithAutoGrow(8))
+	buf.WriteByte('O')
+	buf.WriteRepeat('l', 2)
+	buf.WriteVec([]byte("sz"), []byte("tyn"))
+	if want, got := "Ollsztyn", buf.String(); want != got || buf.Size() != 8 {
+		t.Errorf("auto grow from 0 want: %q, size 8, got: %q, size %d", want, got, buf.Size())
+	}
+
+	buf = NewByteRing(4, WithAutoGrow(16))
+	buf.ReadFrom(strings.NewReader("OlsztynZyje.pl!!"))
+	if want, got := "OlsztynZyje.pl!!", buf.String(); want != got || buf.Size() != 16 {
+		t.Errorf("ReadFrom want: %q, size 16, got: %q, size %d", want, got, buf.Size())
+	}
+
+	buf = NewByteRing(4, WithAutoGrow(16))
+	if n, ok := buf.TryWrite([]byte("Olsztyn")); n != 7 || !ok || buf.Size() != 8 {
+		t.Errorf("TryWrite want: 7, true, size 8, got: %d, %v, size %d", n, ok, buf.Size())
+	}
+
+	buf = NewByteRing(8, WithAutoGrow(64))
+	buf.WriteRecord([]byte("Ols"))
+	buf.WriteRecord([]byte("ztyn"))
+	if _, d := buf.Stats(); d != 0 || buf.Size() != 16 {
+		t.Errorf("WriteRecord want: dropped 0, size 16, got: %d, size %d", d, buf.Size())
+	}
+	if err := buf.WriteRecord(make([]byte, 40)); err != nil || buf.Size() != 64 {
+		t.Errorf("WriteRecord want: nil, size 64, got: %v, size %d", err, buf.Size())
+	}
+}
+
+func TestOnFull(t *testing.T) {
+	buf := NewByteRing(10)
+	calls := 0
+	buf.OnFull(func() {
+		calls++
+		buf.Available() // must not deadlock
+	})
+	var data = []struct {
+		In    string
+		Calls int
+	}{
+		{"Olsztyn", 0},
+		{"Zyj", 1},
+		{"e.pl", 1},
+		{"OlsztynZyje.pl", 1},
+	}
+	for i, d := range data {
+		buf.WriteString(d.In)
+		if calls != d.Calls {
+			t.Errorf("[%d] WriteString(%q) calls want: %d, got: %d", i, d.In, d.Calls, calls)
+		}
+	}
+	buf.Discard(5)
+	buf.WriteString("Olsztyn")
+	if calls != 1 {
+		t.Errorf("refill without Reset calls want: %d, got: %d", 1, calls)
+	}
+	buf.Reset()
+	buf.WriteString("Olsztyn")
+	buf.WriteByte('Z')
+	buf.WriteByte('y')
+	if calls != 1 {
+		t.Errorf("after Reset calls want: %d, got: %d", 1, calls)
+	}
+	buf.WriteByte('j')
+	if calls != 2 {
+		t.Errorf("refill after Reset calls want: %d, got: %d", 2, calls)
+	}
+}
+
+func TestDump(t *testing.T) {
+	buf := NewByteRing(10)
+	var data = []struct {
+		In       string
+		Contents string
+		End      int
+		Full     bool
+	}{
+		{"Olsztyn", "Olsztyn\x00\x00\x00", 7, false},
+		{"Zy", "OlsztynZy\x00", 9, false},
+		{"j", "OlsztynZyj", 0, true},
+		{"e.pl", "e.pltynZyj", 4, true},
+	}
+	for i, d := range data {
+		buf.WriteString(d.In)
+		contents, end, full, size := buf.Dump()
+		if string(contents) != d.Contents || end != d.End || full != d.Full || size != 10 {
+			t.Errorf("[%d] Dump want: %q, %d, %v, 10, got: %q, %d, %v, %d", i, d.Contents, d.End, d.Full, contents, end, full, size)
+		}
+	}
+	contents, _, _, _ := buf.Dump()
+	contents[0] = '!'
+	if want, got := "tynZyje.pl", buf.String(); want != got {
+		t.Errorf("Dump shares memory, want: %q, got: %q", want, got)
+	}
+}
+
+func TestWriterFanIn(t *testing.T) {
+	const producers, records = 8, 100
+	buf := NewByteRing(producers * records * 4)
+	var wg sync.WaitGroup
+	for i := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := buf.Writer()
+			if _, ok := w.(io.ReaderFrom); ok {
+				t.Errorf("Writer implements io.ReaderFrom")
+			}
+			for j := range records {
+				fmt.Fprintf(w, "%d%02d\n", i, j)
+			}
+		}()
+	}
+	wg.Wait()
+	next := make([]int, producers)
+	for line := range buf.Lines() {
+		i, _ := strconv.Atoi(string(line[:1]))
+		j, _ := strconv.Atoi(string(line[1:]))
+		if len(line) != 3 || next[i] != j {
+			t.Fatalf("producer %d record want: %02d, got: %q", i, next[i], line)
+		}
+		next[i]++
+	}
+	for i, n := range next {
+		if n != records {
+			t.Errorf("producer %d records want: %d, got: %d", i, records, n)
+		}
+	}
+}
+
+func TestTee(t *testing.T) {
+	var tee bytes.Buffer
+	buf := NewByteRing(10, WithTee(&tee))
+	buf.WriteString("Olsztyn")
+	buf.Write([]byte("Zyje"))
+	buf.WriteByte('.')
+	buf.WriteVec([]byte("p"), nil, []byte("l"))
+	if want, got := "OlsztynZyje.pl", tee.String(); want != got {
+		t.Errorf("tee want: %q, got: %q", want, got)
+	}
+	if want, got := "tynZyje.pl", buf.String(); want != got {
+		t.Errorf("buffer want: %q, got: %q", want, got)
+	}
+
+	tee.Reset()
+	buf = NewByteRing(10, WithTee(&tee), WithLossless())
+	buf.WriteString("Olsztyn")
+	if _, err := buf.WriteVec([]byte("Zy"), []byte("je")); err != io.ErrShortWrite {
+		t.Errorf("lossless WriteVec want: %v, got: %v", io.ErrShortWrite, err)
+	}
+	if want, got := "OlsztynZyj", tee.String(); want != got {
+		t.Errorf("lossless tee want: %q, got: %q", want, got)
+	}
+
+	errBoom := errors.New("boom")
+	buf = NewByteRing(10, WithTee(errWriter{errBoom}))
+	if n, err := buf.WriteString("Olsztyn"); n != 7 || err != errBoom {
+		t.Errorf("tee error want: 7, %v, got: %d, %v", errBoom, n, err)
+	}
+	if err := buf.WriteByte('Z'); err != errBoom {
+		t.Errorf("tee WriteByte error want: %v, got: %v", errBoom, err)
+	}
+	if want, got := "OlsztynZ", buf.String(); want != got {
+		t.Errorf("tee error buffer want: %q, got: %q", want, got)
+	}
+
+	// io.Copy uses ReadFrom, with and without locking
+	for _, opts := range [][]Option{nil, {WithoutLocking()}} {
+		tee.Reset()
+		buf = NewByteRing(10, append(opts, WithTee(&tee))...)
+		in := strings.Repeat("0123456789", 100) + "hello world"
+		io.Copy(buf, iotest.HalfReader(strings.NewReader(in)))
+		if tee.String() != in {
+			t.Errorf("%v io.Copy tee want: %d bytes, got: %q", opts, len(in), tee.String())
+		}
+	}
+
+	tee.Reset()
+	buf = NewByteRing(20, WithTee(&tee))
+	buf.WriteRepeat('x', 100)
+	buf.Reset()
+	buf.TryWrite([]byte("try"))
+	buf.WriteRecord([]byte("rec"))
+	buf.Fill('f')
+	want := strings.Repeat("x", 100) + "try\x00\x00\x00\x03rec" + strings.Repeat("f", 20)
+	if got := tee.String(); want != got {
+		t.Errorf("tee want: %q, got: %q", want, got)
+	}
+	if w, _ := buf.Stats(); int(w) != len(want)-100 {
+		t.Errorf("tee and Stats written differ, tee: %d, written: %d", len(want)-100, w)
+	}
+}
+
+type errWriter struct{ err error }
+
+func (w errWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestIntervals(t *testing.T) {
+	for i, d := range extensiveData {
+		buf := NewByteRing(d.BufSize)
+		for _, in := range d.In {
+			buf.WriteString(in)
+		}
+		want := buf.Bytes()
+		first, second, release := buf.Intervals()
+		got := append(append([]byte{}, first...), second...)
+		wrapped := buf.wrapped() && buf.end > 0
+		release()
+		if !bytes.Equal(want, got) {
+			t.Errorf("[%d] %q Intervals want: %q, got: %q", i, d.Name, want, got)
+		}
+		if (second != nil) != wrapped {
+			t.Errorf("[%d] %q Intervals second want wrapped: %v, got: %q", i, d.Name, wrapped, second)
+		}
+	}
+	buf := NewByteRing(10)
+	_, _, release := buf.Intervals()
+	release()
+	buf.WriteString("Olsztyn") // doesn't deadlock after release
+}
+
+func TestSegmentedByteRing(t *testing.T) {
+	for _, segSize := range []int{1, 3, 4, 10, 32} {
+		seg := NewSegmentedByteRing(10, segSize)
+		buf := NewByteRing(10)
+		for i, in := range []string{"", "Ol", "sztyn", "Zyj", "e", ".pl", "OlsztynZyje.pl", "!", "0123456789", "abc"} {
+			seg.Write([]byte(in))
+			buf.WriteString(in)
+			if want, got := buf.Bytes(), seg.Bytes(); !bytes.Equal(want, got) || seg.Available() != buf.Available() {
+				t.Errorf("[%d/%d] Write(%q) want: %q, got: %q", segSize, i, in, want, got)
+			}
+			for _, n := range []int{0, 1, 4, 12} {
+				want, got := make([]byte, n), make([]byte, n)
+				if wn, gn := buf.Tail(want), seg.Tail(got); wn != gn || !bytes.Equal(want, got) {
+					t.Errorf("[%d/%d] Tail(%d) want: %q, got: %q", segSize, i, n, want[:wn], got[:gn])
+				}
+				for _, off := range []int{0, 3, 9, 11} {
+					wn, gn := buf.Copy(want, off), seg.Copy(got, off)
+					if wn != gn || !bytes.Equal(want[:wn], got[:gn]) {
+						t.Errorf("[%d/%d] Copy(%d, %d) want: %q, got: %q", segSize, i, n, off, want[:wn], got[:gn])
+					}
+				}
+			}
+			var bw, sw bytes.Buffer
+			buf.WriteTo(&bw)
+			if n, err := seg.WriteTo(&sw); err != nil || n != int64(bw.Len()) || bw.String() != sw.String() {
+				t.Errorf("[%d/%d] WriteTo want: %q, got: %q, %v", segSize, i, bw.String(), sw.String(), err)
+			}
+			if limit := (10+segSize-1)/segSize + 1; len(seg.segs) > limit {
+				t.Errorf("[%d/%d] segments want at most: %d, got: %d", segSize, i, limit, len(seg.segs))
+			}
+		}
+		seg.Reset()
+		if seg.Available() != 0 || len(seg.Bytes()) != 0 {
+			t.Errorf("[%d] Reset left data: %q", segSize, seg.Bytes())
+		}
+	}
+}
+
+func TestRecordRing(t *testing.T) {
+	r := NewRecordRing(3, 4)
+	if r.Cap() != 3 || r.Len() != 0 {
+		t.Errorf("empty RecordRing want: 3, 0, got: %d, %d", r.Cap(), r.Len())
+	}
+	for i := range 7 {
+		if err := r.PushRecord([]byte(fmt.Sprintf("r%03d", i))); err != nil {
+			t.Errorf("PushRecord(%d) err: %s", i, err)
+		}
+	}
+	if err := r.PushRecord([]byte("r7")); err != ErrRecordSize {
+		t.Errorf("PushRecord of a short record want: %v, got: %v", ErrRecordSize, err)
+	}
+	var data = []struct {
+		N    int
+		Want string
+	}{
+		{-1, "[]"},
+		{0, "[]"},
+		{1, "[r006]"},
+		{2, "[r005 r006]"},
+		{3, "[r004 r005 r006]"},
+		{5, "[r004 r005 r006]"},
+	}
+	for i, d := range data {
+		if got := fmt.Sprintf("%s", r.TailRecords(d.N)); d.Want != got {
+			t.Errorf("[%d] TailRecords(%d) want: %s, got: %s", i, d.N, d.Want, got)
+		}
+	}
+
+	r = NewRecordRing(2, 3, WithLossless())
+	r.PushRecord([]byte("abc"))
+	r.PushRecord([]byte("def"))
+	if err := r.PushRecord([]byte("ghi")); err != io.ErrShortWrite {
+		t.Errorf("lossless PushRecord want: %v, got: %v", io.ErrShortWrite, err)
+	}
+	if want, got := "[abc def]", fmt.Sprintf("%s", r.TailRecords(2)); want != got {
+		t.Errorf("lossless TailRecords want: %s, got: %s", want, got)
+	}
+}
+
+func TestWriteToN(t *testing.T) {
+	for _, buf := range []*ByteRing{NewByteRing(10), NewByteRingUnsafe(10)} {
+		buf.WriteString("Olsztyn")
+		buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+		for _, n := range []int{0, 2, 4, 6, 10, 12} {
+			var bbuf bytes.Buffer
+			k, err := buf.WriteToN(&bbuf, n)
+			if want := buf.Peek(n); err != nil || k != len(want) || !bytes.Equal(want, bbuf.Bytes()) {
+				t.Errorf("WriteToN(%d) want: %q, got: %q, %d, %v", n, want, bbuf.Bytes(), k, err)
+			}
+		}
+		if _, err := buf.WriteToN(io.Discard, -1); err != errNegativeSize {
+			t.Errorf("WriteToN(-1) want: %v, got: %v", errNegativeSize, err)
+		}
+	}
+}
+
+func TestLineOffsets(t *testing.T) {
+	buf := NewByteRing(16, WithLineIndex())
+	plain := NewByteRing(16)
+	steps := []func(b *ByteRing){
+		func(b *ByteRing) { b.WriteString("first\nsec") },
+		func(b *ByteRing) { b.WriteString("ond\nthird\n") }, // wraps
+		func(b *ByteRing) { b.WriteByte('\n') },
+		func(b *ByteRing) { b.Discard(3) },
+		func(b *ByteRing) { b.WriteVec([]byte("a\nb"), []byte("\n")) },
+		func(b *ByteRing) { b.WriteRepeat('\n', 3) },
+		func(b *ByteRing) { b.SeekRead(0) },
+		func(b *ByteRing) { b.WriteString("x\ny\nz\nlonger than size\n!") },
+		func(b *ByteRing) { b.ReadFrom(strings.NewReader("\nread\nfrom")) },
+		func(b *ByteRing) { b.WriteAt([]byte("\n\n"), 0) },
+		func(b *ByteRing) { b.Reset() },
+		func(b *ByteRing) { b.WriteString("after\nreset") },
+	}
+	for i, step := range steps {
+		step(buf)
+		step(plain)
+		want := []int{}
+		for j, c := range buf.Bytes() {
+			if c == '\n' {
+				want = append(want, j)
+			}
+		}
+		got := buf.LineOffsets()
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			t.Errorf("[%d] LineOffsets of %q want: %v, got: %v", i, buf.String(), want, got)
+		}
+		if got := plain.LineOffsets(); fmt.Sprint(want) != fmt.Sprint(got) {
+			t.Errorf("[%d] LineOffsets without index of %q want: %v, got: %v", i, plain.String(), want, got)
+		}
+	}
+}
+
+func TestPipe(t *testing.T) {
+	_, r, w := NewPipe(16)
+	in := strings.Repeat("OlsztynZyje.pl\n", 1000)
+	go func() {
+		for i := 0; i < len(in); i += 100 {
+			if _, err := w.Write([]byte(in[i:min(i+100, len(in))])); err != nil {
+				t.Errorf("Write err: %s", err)
+			}
+		}
+		w.Close()
+	}()
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != in {
+		t.Errorf("ReadAll want: %d bytes, got: %d, %v", len(in), len(got), err)
+	}
+
+	_, r, w = NewPipe(4)
+	done := make(chan error)
+	go func() {
+		_, err := w.Write([]byte("OlsztynZyje.pl"))
+		done <- err
+	}()
+	p := make([]byte, 2)
+	r.Read(p)
+	r.Close()
+	if err := <-done; err != io.ErrClosedPipe {
+		t.Errorf("Write after reader Close want: %v, got: %v", io.ErrClosedPipe, err)
+	}
+	if _, err := r.Read(p); err != io.ErrClosedPipe {
+		t.Errorf("Read after Close want: %v, got: %v", io.ErrClosedPipe, err)
+	}
+
+	// a pipe of size 0 buffers a single byte
+	b, r, w := NewPipe(0)
+	if want, got := 1, b.Size(); want != got {
+		t.Errorf("NewPipe(0) Size want: %d, got: %d", want, got)
+	}
+	go func() {
+		w.Write([]byte("Olsztyn"))
+		w.Close()
+	}()
+	if got, err := io.ReadAll(r); err != nil || string(got) != "Olsztyn" {
+		t.Errorf("NewPipe(0) ReadAll want: %q, nil, got: %q, %v", "Olsztyn", got, err)
+	}
+}
+
+func TestFromSliceAliasing(t *testing.T) {
+	arr := []byte("OlsztynZyje.pl")
+	buf := NewByteRingFromSlice(arr[:7])
+	buf.WriteString("abcdefghij")
+	buf.ResetAndResize(10)
+	buf.WriteString("0123456789")
+	if want, got := "OlsztynZyje.pl"[7:], string(arr[7:]); want != got {
+		t.Errorf("memory beyond len(buf) changed, want: %q, got: %q", want, got)
+	}
+
+	buf = NewByteRingFromSlice([]byte("Olsztyn"), WithContents())
+	if want, got := "Olsztyn", string(buf.Bytes()); want != got || !buf.IsFull() {
+		t.Errorf("WithContents want: %q, full, got: %q, %v", want, got, buf.IsFull())
+	}
+	buf.WriteString("Zyj")
+	if want, got := "ztynZyj", buf.String(); want != got {
+		t.Errorf("write after WithContents want: %q, got: %q", want, got)
+	}
+	if buf = NewByteRingFromSlice(nil, WithContents()); buf.IsFull() || buf.Available() != 0 {
+		t.Errorf("WithContents of empty slice want empty buffer")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	var bbuf bytes.Buffer
+	if n, err := buf.Flush(&bbuf); err != nil || n != 10 || bbuf.String() != "tynZyje.pl" {
+		t.Errorf("Flush want: 10, %q, got: %d, %q, %v", "tynZyje.pl", n, bbuf.String(), err)
+	}
+	if buf.Available() != 0 {
+		t.Errorf("Flush left data: %q", buf.String())
+	}
+
+	buf.WriteString("Olsztyn")
+	bbuf.Reset()
+	if n, err := buf.Flush(errorAfter{&bbuf, 3}); n != 3 || err != io.ErrShortWrite {
+		t.Errorf("failed Flush want: 3, %v, got: %d, %v", io.ErrShortWrite, n, err)
+	}
+	if want, got := "ztyn", buf.String(); want != got || bbuf.String() != "Ols" {
+		t.Errorf("failed Flush want: %q, got: %q", want, got)
+	}
+}
+
+type errorAfter struct {
+	w io.Writer
+	n int
+}
+
+func (e errorAfter) Write(p []byte) (int, error) {
+	n, _ := e.w.Write(p[:min(len(p), e.n)])
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+func TestFlushConcurrent(t *testing.T) {
+	buf := NewByteRing(1 << 16)
+	var flushed bytes.Buffer
+	const writers, records = 4, 500
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range records {
+				fmt.Fprintf(buf, "%d%03d\n", i, j)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			buf.Flush(&flushed)
+		}
+	}()
+	wg.Wait()
+	<-done
+	buf.Flush(&flushed)
+	if want, got := writers*records*5, flushed.Len(); want != got {
+		t.Errorf("flushed bytes want: %d, got: %d", want, got)
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSuffix(flushed.String(), "\n"), "\n") {
+		if seen[line] {
+			t.Errorf("line %q flushed twice", line)
+		}
+		seen[line] = true
+	}
+	if len(seen) != writers*records {
+		t.Errorf("flushed lines want: %d, got: %d", writers*records, len(seen))
+	}
+}
+
+func TestTinySizes(t *testing.T) {
+	for _, size := range []int{0, 1} {
+		for _, opts := range [][]Option{nil, {WithoutLocking()}, {WithLossless()}, {WithLineIndex()}} {
+			buf := NewByteRing(size, opts...)
+			want := "Olsztyn"[7-min(size, 7):]
+			if buf.lossless {
+				want = "O"[:size]
+			}
+			buf.WriteString("Ol")
+			buf.Write([]byte("sz"))
+			buf.WriteByte('t')
+			buf.WriteVec([]byte("y"), []byte("n"))
+			if got := buf.String(); want != got || buf.Available() != len(want) {
+				t.Errorf("[%d] %v want: %q, got: %q", size, opts, want, got)
+			}
+			if size == 0 && buf.IsFull() {
+				t.Errorf("[0] IsFull want: false")
+			}
+			d := make([]byte, 2)
+			if n := buf.Tail(d); string(d[:n]) != want {
+				t.Errorf("[%d] Tail want: %q, got: %q", size, want, d[:n])
+			}
+			for _, off := range []int{0, 1, 2} {
+				buf.Copy(d, off)
+				buf.CopyN(d, off, 1)
+				buf.PeekAt(off, 1)
+				buf.At(off)
+				buf.ReadAt(d, int64(off))
+				buf.WriteToRange(io.Discard, off, 1)
+			}
+			var bbuf bytes.Buffer
+			if buf.WriteTo(&bbuf); bbuf.String() != want {
+				t.Errorf("[%d] WriteTo want: %q, got: %q", size, want, bbuf.String())
+			}
+			buf.Peek(2)
+			buf.IndexByte('n')
+			buf.LastIndexByte('n')
+			buf.Index([]byte("n"))
+			buf.CountByte('n')
+			buf.LineOffsets()
+			buf.Checksum()
+			for range buf.Lines() {
+			}
+			buf.WriteToN(io.Discard, 2)
+			buf.WriteAt([]byte("x"), 0)
+			buf.Compact()
+			buf.Clone()
+			buf.AppendTo(nil)
+			buf.TryWrite([]byte("ab"))
+			buf.WriteRepeat('r', 3)
+			buf.ReadFrom(strings.NewReader("abc"))
+			buf.Fill('f')
+			data, _ := buf.MarshalBinary()
+			if err := buf.UnmarshalBinary(data); err != nil {
+				t.Errorf("[%d] UnmarshalBinary err: %s", size, err)
+			}
+			buf.Read(d)
+			buf.UnreadByte()
+			buf.ReadByte()
+			buf.SeekRead(0)
+			buf.Discard(1)
+			buf.Truncate(1)
+			buf.Drain(d)
+			buf.Flush(io.Discard)
+			buf.Grow(size)
+			buf.Reset()
+			if buf.Available() != 0 || buf.Size() != size {
+				t.Errorf("[%d] Reset want: 0, %d, got: %d, %d", size, size, buf.Available(), buf.Size())
+			}
+		}
+	}
+}
+
+func TestRandomOperations(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for _, size := range []int{0, 1, 2, 3, 7, 16} {
+		buf := NewByteRing(size)
+		for i := range 2000 {
+			d := make([]byte, rnd.IntN(2*size+2))
+			switch op := rnd.IntN(10); {
+			case op < 4:
+				buf.Write(d)
+			case op < 5:
+				buf.Read(d)
+			case op < 6:
+				buf.Reset()
+			case op < 8:
+				buf.Tail(d)
+			default:
+				buf.Copy(d, rnd.IntN(2*size+2))
+			}
+			_ = buf.String()
+			buf.WriteTo(io.Discard)
+			if n := buf.Available(); n < 0 || n > size {
+				t.Fatalf("[%d/%d] Available want: [0, %d], got: %d", size, i, size, n)
+			}
+		}
+	}
+}
+
+// FuzzReference compares ByteRing with a naive model which keeps unread data
+// in a plain slice. Each byte of ops is an operation.
+func FuzzReference(f *testing.F) {
+	f.Add(uint8(10), []byte{7, 7, 0x83, 5, 0x40, 9})
+	f.Add(uint8(1), []byte{1, 2, 0x81, 0xc0, 3})
+	f.Add(uint8(4), []byte{3, 0x82, 4, 0xc0, 6, 0x81, 1})
+	f.Fuzz(func(t *testing.T, size uint8, ops []byte) {
+		buf := NewByteRing(int(size % 32))
+		var ref []byte
+		next := byte(0)
+		for _, op := range ops {
+			n := int(op & 0x3f)
+			switch op >> 6 {
+			case 0, 1: // write n bytes
+				d := make([]byte, n)
+				for i := range d {
+					d[i] = next
+					next++
+				}
+				buf.Write(d)
+				ref = append(ref, d...)
+				ref = ref[max(len(ref)-buf.Size(), 0):]
+			case 2: // read n bytes
+				buf.Read(make([]byte, n))
+				ref = ref[min(n, len(ref)):]
+			case 3:
+				buf.Reset()
+				ref = ref[:0]
+			}
+			if got := buf.Bytes(); !bytes.Equal(ref, got) {
+				t.Fatalf("Bytes want: %v, got: %v", ref, got)
+			}
+			for l := 0; l <= buf.Size()+1; l++ {
+				d := make([]byte, l)
+				want := ref[len(ref)-min(l, len(ref)):]
+				if k := buf.Tail(d); !bytes.Equal(want, d[:k]) {
+					t.Fatalf("Tail(%d) want: %v, got: %v", l, want, d[:k])
+				}
+				for off := 0; off <= buf.Size()+1; off++ {
+					want := ref[min(off, len(ref)):]
+					want = want[:min(l, len(want))]
+					if k := buf.Copy(d, off); !bytes.Equal(want, d[:k]) {
+						t.Fatalf("Copy(%d, %d) want: %v, got: %v", l, off, want, d[:k])
+					}
+				}
+			}
+		}
+	})
+}
+
+func TestCopyOffsets(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // "tynZyje.pl", physically "e.pltynZyj"
+	dest := make([]byte, 4)
+	for _, off := range []int{-100, -11, -10, -1, 10, 11, 100} {
+		if n := buf.Copy(dest, off); n != 0 {
+			t.Errorf("Copy(%d) want: 0, got: %d", off, n)
+		}
+		if n := buf.CopyN(dest, off, 2); n != 0 {
+			t.Errorf("CopyN(%d) want: 0, got: %d", off, n)
+		}
+	}
+}
+
+func TestTailZeroPad(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyj") // "OlsztynZyj", physically the same, full
+	buf.Discard(4)
+	var data = []struct {
+		Len  int
+		N    int
+		Want string
+	}{
+		{0, 0, ""},
+		{3, 3, "Zyj"},
+		{6, 6, "tynZyj"},
+		{8, 6, "\x00\x00tynZyj"},
+	}
+	for i, d := range data {
+		dest := bytes.Repeat([]byte{'#'}, d.Len)
+		n := buf.TailZeroPad(dest)
+		if n != d.N || d.Want != string(dest) {
+			t.Errorf("[%d] TailZeroPad(%d) want: %d, %q, got: %d, %q", i, d.Len, d.N, d.Want, n, dest)
+		}
+	}
+}
+
+func TestReadChunk(t *testing.T) {
+	buf := NewByteRing(10, WithReadChunk(3))
+	r := &countingReader{r: strings.NewReader("OlsztynZyje.pl")}
+	buf.ReadFrom(r)
+	if want, got := "tynZyje.pl", buf.String(); want != got || r.max != 3 {
+		t.Errorf("WithReadChunk want: %q, 3, got: %q, %d", want, got, r.max)
+	}
+	if n := testing.AllocsPerRun(10, func() {
+		buf.ReadFrom(strings.NewReader("OlsztynZyje.pl"))
+	}); n > 1 { // strings.Reader itself
+		t.Errorf("ReadFrom allocs want: 1, got: %v", n)
+	}
+}
+
+type countingReader struct {
+	r   io.Reader
+	max int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.max = max(c.max, len(p))
+	return c.r.Read(p)
+}
+
+func BenchmarkReadFromFull(b *testing.B) {
+	buf := NewByteRing(1024)
+	d := bytes.Repeat([]byte(benchText), 16)
+	r := bytes.NewReader(d)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(d)))
+	for i := 0; i < b.N; i++ {
+		r.Reset(d)
+		buf.ReadFrom(r)
+	}
+}
+
+func TestWriteToSnapshot(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.Write([]byte("Olsztyn"))
+	buf.Write([]byte("Zyje.pl"))
+	var w bytes.Buffer
+	if n, err := buf.WriteToSnapshot(&w); err != nil || n != 10 {
+		t.Errorf("WriteToSnapshot want: 10, nil, got: %d, %v", n, err)
+	}
+	if want, got := "tynZyje.pl", w.String(); want != got {
+		t.Errorf("WriteToSnapshot want: %q, got: %q", want, got)
+	}
+
+	// writers only write whole records of a single repeated byte, so every
+	// snapshot must consist of complete records
+	const record = 8
+	buf = NewByteRing(10 * record)
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := bytes.Repeat([]byte{'a' + byte(i)}, record)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					buf.Write(d)
+				}
+			}
+		}()
+	}
+	for range 1000 {
+		w.Reset()
+		buf.WriteToSnapshot(&w)
+		d := w.Bytes()
+		if len(d)%record != 0 {
+			t.Fatalf("WriteToSnapshot torn length: %d", len(d))
+		}
+		for j := 0; j < len(d); j += record {
+			if want, got := bytes.Repeat(d[j:j+1], record), d[j:j+record]; !bytes.Equal(want, got) {
+				t.Fatalf("WriteToSnapshot torn record want: %q, got: %q", want, got)
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestPeekNCommit(t *testing.T) {
+	buf := NewByteRing(10)
+	buf.WriteString("Olsztyn")
+	if want, got := "Ols", string(buf.PeekN(3)); want != got {
+		t.Errorf("PeekN want: %q, got: %q", want, got)
+	}
+	// writes which don't overwrite peeked bytes are fine
+	buf.WriteString("Zy")
+	if err := buf.Commit(3); err != nil {
+		t.Errorf("Commit want: nil, got: %v", err)
+	}
+	if want, got := "ztynZy", buf.String(); want != got {
+		t.Errorf("Commit want: %q, got: %q", want, got)
+	}
+	if err := buf.Commit(3); err != errOutOfRange {
+		t.Errorf("second Commit want: %v, got: %v", errOutOfRange, err)
+	}
+	// WriteAt beyond peeked bytes is fine
+	buf.PeekN(2)
+	buf.WriteAt([]byte("Y"), 4)
+	if err := buf.Commit(2); err != nil {
+		t.Errorf("Commit after WriteAt want: nil, got: %v", err)
+	}
+
+	// Restore brings back bytes which were never peeked
+	buf = NewByteRing(10)
+	buf.WriteString("ab")
+	s := buf.Snapshot()
+	buf.Discard(2)
+	buf.WriteString("cd")
+	if want, got := "cd", string(buf.PeekN(2)); want != got {
+		t.Errorf("PeekN want: %q, got: %q", want, got)
+	}
+	if err := buf.Restore(s); err != nil {
+		t.Errorf("Restore err: %s", err)
+	}
+	if err := buf.Commit(2); err != ErrPeekLost {
+		t.Errorf("Commit after Restore want: %v, got: %v", ErrPeekLost, err)
+	}
+	if want, got := "ab", buf.String(); want != got {
+		t.Errorf("Commit after Restore want: %q, got: %q", want, got)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*ByteRing)
+	}{
+		{"evicted", func(b *ByteRing) { b.WriteString("je.pl") }},
+		{"read", func(b *ByteRing) { b.ReadByte() }},
+		{"reset", func(b *ByteRing) { b.Reset(); b.WriteString("ztynZy") }},
+		{"WriteAt", func(b *ByteRing) { b.WriteAt([]byte("T"), 3) }},
+		{"Restore", func(b *ByteRing) { b.Restore(b.Snapshot()) }},
+	}
+	for _, tc := range tests {
+		buf := NewByteRing(10)
+		buf.WriteString("ztynZy")
+		buf.PeekN(4)
+		tc.change(buf)
+		before := buf.String()
+		if err := buf.Commit(4); err != ErrPeekLost {
+			t.Errorf("%s: Commit want: %v, got: %v", tc.name, ErrPeekLost, err)
+		}
+		if after := buf.String(); before != after {
+			t.Errorf("%s: failed Commit changed buffer from %q to %q", tc.name, before, after)
+		}
+	}
+}
+
+func TestWithAllocator(t *testing.T) {
+	var sizes []int
+	alloc := func(size int) []byte {
+		sizes = append(sizes, size)
+		return make([]byte, size, size+100) // extra capacity is not used
+	}
+	buf := NewByteRing(10, WithAllocator(alloc), WithAutoGrow(40))
+	buf.WriteString("Olsztyn")
+	buf.WriteString("Zyje.pl") // grows to 20
+	buf.Resize(30)
+	buf.ResetAndResize(25) // reuses the slice of size 30
+	buf.ResetAndResize(50)
+	if want := []int{10, 20, 30, 50}; !slices.Equal(want, sizes) {
+		t.Errorf("WithAllocator sizes want: %v, got: %v", want, sizes)
+	}
+	if want, got := 50, buf.Size(); want != got {
+		t.Errorf("WithAllocator Size want: %d, got: %d", want, got)
+	}
+
+	sizes = nil
+	buf = NewByteRingFromSlice(make([]byte, 10), WithAllocator(alloc))
+	if len(sizes) != 0 {
+		t.Errorf("NewByteRingFromSlice called allocator: %v", sizes)
+	}
+}
+
+type blockingWriter struct {
+	started, release chan struct{}
+}
+
+func (w blockingWriter) Write(p []byte) (int, error) {
+	close(w.started)
+	<-w.release
+	return len(p), nil
+}
+
+func TestResetDuringWriteTo(t *testing.T) {
+	buf := NewByteRing(10, WithZeroOnReset())
+	buf.WriteString("secret!!")
+	w := blockingWriter{make(chan struct{}), make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		buf.WriteTo(w)
+		close(done)
+	}()
+	<-w.started
+	// doesn't wait for w
+	buf.Reset()
+	buf.ResetZero()
+	buf.ResetAndResize(10)
+	close(w.release)
+	<-done
+	if bytes.ContainsAny(buf.scratch[:cap(buf.scratch)], "secret!") {
+		t.Errorf("WriteTo left data in memory: %q", buf.scratch[:cap(buf.scratch)])
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 to Paweł Szczur.  All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bytering
+
+import "bytes"
+
+// lineIndex holds positions of newlines in buffer, see WithLineIndex.
+// Positions are absolute, counted from an arbitrary origin, so they don't
+// change when data is read or overwritten.
+type lineIndex struct {
+	enabled bool
+	valid   bool     // nl matches data, otherwise it's rebuilt when needed
+	end     uint64   // absolute position of end
+	nl      []uint64 // ascending, may include positions no longer in buffer
+}
+
+// indexLines adds newlines of n bytes just placed in the underlying slice
+// after end, before advancing end. If n >= Size(), the last Size() bytes are
+// expected at the beginning of the slice.
+func (b *ByteRing) indexLines(n int) {
+	l := &b.lines
+	if !l.valid {
+		return
+	}
+	first, second := b.b, []byte(nil)
+	pos := l.end + uint64(max(n-b.capacity, 0))
+	if n < b.capacity {
+		first, second = b.b[b.end:min(b.end+n, b.capacity)], b.b[:max(b.end+n-b.capacity, 0)]
+	}
+	l.end += uint64(n)
+	// drop newlines which are surely overwritten
+	i := 0
+	for i < len(l.nl) && l.nl[i]+uint64(b.capacity) < l.end {
+		i++
+	}
+	l.nl = append(l.nl[:0], l.nl[i:]...)
+	for _, d := range [][]byte{first, second} {
+		for j := 0; ; {
+			k := bytes.IndexByte(d[j:], '\n')
+			if k < 0 {
+				break
+			}
+			l.nl = append(l.nl, pos+uint64(j+k))
+			j += k + 1
+		}
+		pos += uint64(len(d))
+	}
+}
+
+// rebuildLines rescans all data still held in buffer, including bytes
+// already read.
+func (b *ByteRing) rebuildLines() {
+	l := &b.lines
+	held := b.behind + b.available()
+	l.nl = l.nl[:0]
+	l.end = uint64(held)
+	i := b.start - b.behind
+	if i < 0 {
+		i += b.capacity
+	}
+	for k := range held {
+		if b.b[(i+k)%b.capacity] == '\n' {
+			l.nl = append(l.nl, uint64(k))
+		}
+	}
+	l.valid = true
+}
+
+// LineOffsets returns offsets of all '\n' bytes in unread data, where offset
+// 0 means the oldest unread byte. If the ByteRing was created WithLineIndex,
+// the offsets are maintained by writes, otherwise data is scanned.
+func (b *ByteRing) LineOffsets() []int {
+	b.lock()
+	defer b.unlock()
+	offsets := []int{}
+	if !b.lines.enabled {
+		first, second := b.intervals()
+		for i, d := range [][]byte{first, second} {
+			base := i * len(first)
+			for j := 0; ; {
+				k := bytes.IndexByte(d[j:], '\n')
+				if k < 0 {
+					break
+				}
+				offsets = append(offsets, base+j+k)
+				j += k + 1
+			}
+		}
+		return offsets
+	}
+	if !b.lines.valid {
+		b.rebuildLines()
+	}
+	start := b.lines.end - uint64(b.available())
+	for _, p := range b.lines.nl {
+		if p >= start {
+			offsets = append(offsets, int(p-start))
+		}
+	}
+	return offsets
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 to Paweł Szczur.  All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bytering
+
+import "io"
+
+// Option configures a ByteRing created by NewByteRing.
+type Option func(*ByteRing)
+
+// WithoutLocking disables all locking. The ByteRing is faster but NOT thread
+// safe, it must be used only by a single goroutine at a time.
+func WithoutLocking() Option {
+	return func(b *ByteRing) {
+		b.nolock = true
+	}
+}
+
+// WithOverflowFunc sets a function called with bytes dropped by writes, see
+// OnOverflow.
+func WithOverflowFunc(fn func(dropped []byte)) Option {
+	return func(b *ByteRing) {
+		b.onOverflow = fn
+	}
+}
+
+// WithZeroOnReset makes Reset overwrite the underlying slice with zeros, see
+// ResetZero.
+func WithZeroOnReset() Option {
+	return func(b *ByteRing) {
+		b.zeroOnReset = true
+	}
+}
+
+// WithLossless makes writes never overwrite unread data. Instead they write
+// as many bytes as fit and return io.ErrShortWrite. Together with Read it
+// makes the ByteRing a bounded FIFO queue with backpressure.
+func WithLossless() Option {
+	return func(b *ByteRing) {
+		b.lossless = true
+	}
+}
+
+// WithObserver sets obs to be notified about writes, see Observer.
+func WithObserver(obs Observer) Option {
+	return func(b *ByteRing) {
+		b.observer = obs
+	}
+}
+
+// WithAutoGrow makes writes which would overwrite unread data grow buffer
+// instead, doubling its size up to max bytes. Once the size reaches max,
+// writes overwrite the oldest data as usual, or fail WithLossless.
+func WithAutoGrow(max int) Option {
+	return func(b *ByteRing) {
+		b.maxGrow = max
+	}
+}
+
+// WithTee makes Write, WriteString, WriteByte, WriteVec, WriteRepeat,
+// TryWrite, WriteRecord, ReadFrom and Fill also write all data they store
+// into w, including data later overwritten in buffer. In lossless mode only
+// the written part is passed. The tee writer is called holding the lock, so
+// it receives data in order. Its error is returned by the write, but data is
+// stored in buffer nevertheless. TryWrite and Fill have no error result, so
+// errors of the tee writer during those calls are lost; use a tee writer
+// which records its own errors if they matter.
+func WithTee(w io.Writer) Option {
+	return func(b *ByteRing) {
+		b.tee = w
+	}
+}
+
+// WithLineIndex makes writes maintain positions of newlines, so LineOffsets
+// doesn't need to scan data.
+func WithLineIndex() Option {
+	return func(b *ByteRing) {
+		b.lines.enabled = true
+	}
+}
+
+// WithContents makes the ByteRing start full, with the whole underlying slice
+// as unread data. It's meant for NewByteRingFromSlice adopting a filled
+// slice, with NewByteRing data are zeros.
+func WithContents() Option {
+	return func(b *ByteRing) {
+		b.full = b.capacity > 0
+	}
+}
+
+// WithReadChunk sets the size of chunks read by ReadFrom, which is also the
+// size of its pooled temporary slices.
+func WithReadChunk(size int) Option {
+	return func(b *ByteRing) {
+		b.readChunk = size
+	}
+}
+
+// WithAllocator makes the ByteRing obtain its underlying slices from alloc
+// instead of make, e.g. to use memory mapped files or huge pages. alloc is
+// called with the size of buffer by NewByteRing, Resize, ResetAndResize,
+// UnmarshalBinary and writes growing buffer WithAutoGrow. It must return a
+// slice of at least size bytes, only the first size bytes are used. Replaced
+// slices are not released, the caller is responsible for that.
+func WithAllocator(alloc func(size int) []byte) Option {
+	return func(b *ByteRing) {
+		b.alloc = alloc
+	}
+}
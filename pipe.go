@@ -0,0 +1,69 @@
+// Copyright 2015 to Paweł Szczur.  All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bytering
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+)
+
+// NewPipe creates a bounded in-memory pipe, like io.Pipe but buffering up to
+// size bytes. Writes into the RingWriter block while the buffer is full and
+// reads from the RingReader block while it's empty. The returned ByteRing is
+// the buffer itself, created WithLossless, it can be used to inspect data.
+//
+// Closing the writer makes the reader return remaining data and then io.EOF.
+// Closing the reader makes pending and later writes fail with
+// io.ErrClosedPipe.
+//
+// A size smaller than 1 is treated as 1, a pipe without buffer could never
+// accept a write.
+func NewPipe(size int) (*ByteRing, *RingReader, *RingWriter) {
+	b := NewByteRing(max(size, 1), WithLossless())
+	return b, &RingReader{b: b}, &RingWriter{b: b}
+}
+
+// RingReader is the read half of a pipe created by NewPipe.
+type RingReader struct {
+	b      *ByteRing
+	closed atomic.Bool
+}
+
+// Read reads data from the pipe, it waits until some data is written or the
+// writer is closed.
+func (r *RingReader) Read(p []byte) (int, error) {
+	if r.closed.Load() {
+		return 0, io.ErrClosedPipe
+	}
+	return r.b.BlockingRead(p)
+}
+
+// Close closes the reader, writes into the pipe fail with io.ErrClosedPipe.
+func (r *RingReader) Close() error {
+	r.closed.Store(true)
+	return r.b.Close()
+}
+
+// RingWriter is the write half of a pipe created by NewPipe.
+type RingWriter struct {
+	b *ByteRing
+}
+
+// Write writes p into the pipe, it waits until all of p fits into the
+// buffer or the pipe is closed.
+func (w *RingWriter) Write(p []byte) (int, error) {
+	n, err := w.b.WriteContext(context.Background(), p)
+	if err == ErrClosed {
+		err = io.ErrClosedPipe
+	}
+	return n, err
+}
+
+// Close closes the writer, the reader returns remaining data and then
+// io.EOF.
+func (w *RingWriter) Close() error {
+	return w.b.Close()
+}
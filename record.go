@@ -0,0 +1,108 @@
+// Copyright 2015 to Paweł Szczur.  All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bytering
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrRecordTooLarge is returned by WriteRecord if a record with its header
+// doesn't fit into buffer.
+var ErrRecordTooLarge = errors.New("bytering: record too large")
+
+// recordHeaderSize is the size of a big-endian length preceding each record.
+const recordHeaderSize = 4
+
+// WriteRecord writes p as a single record prefixed with its length, which
+// takes additional 4 bytes. If there is no space for the record, whole oldest
+// records are dropped, so ReadRecord never sees a partial one. In lossless
+// mode it returns io.ErrShortWrite instead and nothing is written.
+//
+// Records must not be mixed with other writes into the same ByteRing.
+func (b *ByteRing) WriteRecord(p []byte) error {
+	size := recordHeaderSize + len(p)
+	var hdr [recordHeaderSize]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(p)))
+
+	b.lock()
+	if b.closed {
+		b.unlock()
+		return ErrClosed
+	}
+	b.autoGrow(size)
+	if size > b.capacity || uint64(len(p)) > 1<<32-1 {
+		b.unlock()
+		return ErrRecordTooLarge
+	}
+	free := b.capacity - b.available()
+	if b.lossless && size > free {
+		b.unlock()
+		return io.ErrShortWrite
+	}
+	// find whole records to drop
+	k := 0
+	for free+k < size {
+		k += recordHeaderSize + b.recordLen(k)
+	}
+	var dropped []byte
+	if k > 0 {
+		if b.onOverflow != nil {
+			dropped = make([]byte, k)
+			b.copyAt(dropped, 0)
+		}
+		b.discard(k)
+		b.behind = 0 // bytes before start belong to dropped records
+		b.count(0, k, false)
+	}
+	write(b, hdr[:])
+	write(b, p)
+	err := tee(b, hdr[:])
+	if err == nil {
+		err = tee(b, p)
+	}
+	fn := b.onOverflow
+	b.unlockReport()
+	if dropped != nil {
+		fn(dropped)
+	}
+	return err
+}
+
+// ReadRecord reads and consumes the oldest record written by WriteRecord. If
+// there is no record, err is io.EOF. If there is only a part of a record,
+// err is io.ErrUnexpectedEOF and nothing is consumed.
+func (b *ByteRing) ReadRecord() ([]byte, error) {
+	b.lock()
+	defer b.unlock()
+	available := b.available()
+	if available == 0 {
+		return nil, io.EOF
+	}
+	if available < recordHeaderSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n := b.recordLen(0)
+	if available < recordHeaderSize+n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := make([]byte, n)
+	b.copyAt(p, recordHeaderSize)
+	b.discard(recordHeaderSize + n)
+	b.behind += recordHeaderSize + n
+	return p, nil
+}
+
+// recordLen returns the length of a record starting at offset, clamped to
+// the available data.
+func (b *ByteRing) recordLen(offset int) int {
+	var hdr [recordHeaderSize]byte
+	if b.copyAt(hdr[:], offset) < recordHeaderSize {
+		return b.available() - offset - recordHeaderSize
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	return int(min(uint64(n), uint64(b.available()-offset-recordHeaderSize)))
+}
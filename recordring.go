@@ -0,0 +1,64 @@
+// Copyright 2015 to Paweł Szczur.  All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bytering
+
+import "errors"
+
+// ErrRecordSize is returned by PushRecord for a record of a wrong size.
+var ErrRecordSize = errors.New("bytering: invalid record size")
+
+// RecordRing keeps the last records of a fixed size. The size of its
+// ByteRing is a multiple of the record size and every write is a whole
+// record, so overflow always drops whole oldest records and a record is
+// never split.
+type RecordRing struct {
+	b    *ByteRing
+	size int
+}
+
+// NewRecordRing creates a new RecordRing holding up to n records of
+// recordSize bytes. The ByteRing is configured with opts, which must not
+// change its size, e.g. WithAutoGrow.
+func NewRecordRing(n, recordSize int, opts ...Option) *RecordRing {
+	recordSize = max(recordSize, 1)
+	return &RecordRing{
+		b:    NewByteRing(max(n, 0)*recordSize, opts...),
+		size: recordSize,
+	}
+}
+
+// PushRecord writes p as the newest record, dropping the oldest one if the
+// RecordRing is full. It returns ErrRecordSize if len(p) isn't the record
+// size, and errors of ByteRing.Write, e.g. io.ErrShortWrite in lossless
+// mode.
+func (r *RecordRing) PushRecord(p []byte) error {
+	if len(p) != r.size {
+		return ErrRecordSize
+	}
+	_, err := r.b.Write(p)
+	return err
+}
+
+// Len returns the number of records held.
+func (r *RecordRing) Len() int {
+	return r.b.Available() / r.size
+}
+
+// Cap returns the maximal number of records held.
+func (r *RecordRing) Cap() int {
+	return r.b.Size() / r.size
+}
+
+// TailRecords returns copies of the newest n records, from the oldest to the
+// newest. If n is larger than Len(), all records are returned.
+func (r *RecordRing) TailRecords(n int) [][]byte {
+	d := r.b.Peek(max(n, 0) * r.size)
+	records := make([][]byte, 0, len(d)/r.size)
+	for len(d) > 0 {
+		records = append(records, d[:r.size:r.size])
+		d = d[r.size:]
+	}
+	return records
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 to Paweł Szczur.  All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bytering
+
+import (
+	"bufio"
+	"errors"
+)
+
+// Scanner splits unread data of a ByteRing into tokens, like bufio.Scanner,
+// but without consuming it. Data is copied on the first call to Scan, later
+// writes into the ByteRing are not seen.
+type Scanner struct {
+	b     *ByteRing
+	split bufio.SplitFunc
+	data  []byte // data not yet split, nil before the first Scan
+	token []byte
+	err   error
+	done  bool
+}
+
+// NewScanner returns a Scanner of unread data of b. By default it splits data
+// into lines with bufio.ScanLines.
+func NewScanner(b *ByteRing) *Scanner {
+	return &Scanner{b: b, split: bufio.ScanLines}
+}
+
+// Split sets the split function, it must be called before Scan.
+func (s *Scanner) Split(split bufio.SplitFunc) {
+	s.split = split
+}
+
+// Scan advances to the next token, which is then available through Bytes.
+// It returns false when there are no more tokens or the split function
+// returned an error, see Err. The split function always gets all remaining
+// data with atEOF set to true.
+func (s *Scanner) Scan() bool {
+	if s.done {
+		return false
+	}
+	if s.data == nil {
+		s.data = s.b.Bytes()
+	}
+	for len(s.data) > 0 {
+		advance, token, err := s.split(s.data, true)
+		if err != nil {
+			s.done = true
+			if errors.Is(err, bufio.ErrFinalToken) {
+				s.token = token
+				return token != nil
+			}
+			s.err = err
+			return false
+		}
+		if advance < 0 || advance > len(s.data) {
+			s.done = true
+			s.err = errOutOfRange
+			return false
+		}
+		s.data = s.data[advance:]
+		if token != nil {
+			s.token = token
+			return true
+		}
+		if advance == 0 {
+			break
+		}
+	}
+	s.done = true
+	s.token = nil
+	return false
+}
+
+// Bytes returns the most recent token found by Scan. It shares memory with
+// the Scanner, not with the ByteRing.
+func (s *Scanner) Bytes() []byte {
+	return s.token
+}
+
+// Text returns the most recent token found by Scan as a string.
+func (s *Scanner) Text() string {
+	return string(s.token)
+}
+
+// Err returns the error returned by the split function, if any.
+func (s *Scanner) Err() error {
+	return s.err
+}
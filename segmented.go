@@ -0,0 +1,179 @@
+// Copyright 2015 to Paweł Szczur.  All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bytering
+
+import (
+	"io"
+	"sync"
+)
+
+// SegmentedByteRing keeps the last Size() written bytes like ByteRing, but
+// stores them in a chain of fixed size segments instead of a single slice.
+// Segments are allocated as data arrives and the oldest segment is reused
+// once all its bytes are overwritten, so a large buffer never needs a large
+// contiguous allocation. It uses at most one segment more than Size()
+// requires.
+//
+// The SegmentedByteRing structure is thread safe.
+type SegmentedByteRing struct {
+	m        sync.RWMutex
+	segs     [][]byte // oldest first, all but the last one are full
+	spare    []byte   // an evicted segment to reuse
+	segSize  int
+	capacity int
+	length   int // number of bytes held in segs, may exceed capacity
+}
+
+// NewSegmentedByteRing creates a new SegmentedByteRing of a given size using
+// segments of segmentSize bytes.
+func NewSegmentedByteRing(size, segmentSize int) *SegmentedByteRing {
+	return &SegmentedByteRing{
+		segSize:  max(segmentSize, 1),
+		capacity: max(size, 0),
+	}
+}
+
+// Size returns a size of buffer.
+func (s *SegmentedByteRing) Size() int {
+	return s.capacity
+}
+
+// Available returns a number of bytes currently held in buffer.
+func (s *SegmentedByteRing) Available() int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.available()
+}
+
+func (s *SegmentedByteRing) available() int {
+	return min(s.length, s.capacity)
+}
+
+// Write writes a byte slice into buffer. Like ByteRing.Write, only the last
+// Size() bytes are retained and it always returns len(d) and nil error.
+func (s *SegmentedByteRing) Write(d []byte) (int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	n := len(d)
+	if n >= s.capacity {
+		// all data held so far is overwritten
+		d = d[n-s.capacity:]
+		for len(s.segs) > 0 {
+			s.evict()
+		}
+	}
+	for len(d) > 0 {
+		last := len(s.segs) - 1
+		if last < 0 || len(s.segs[last]) == s.segSize {
+			s.segs = append(s.segs, s.newSegment())
+			last++
+		}
+		seg := s.segs[last]
+		k := copy(seg[len(seg):s.segSize], d)
+		s.segs[last] = seg[:len(seg)+k]
+		s.length += k
+		d = d[k:]
+		for len(s.segs) > 1 && s.length-len(s.segs[0]) >= s.capacity {
+			s.evict()
+		}
+	}
+	return n, nil
+}
+
+// newSegment returns an empty segment, reusing the spare one if possible.
+func (s *SegmentedByteRing) newSegment() []byte {
+	if seg := s.spare; seg != nil {
+		s.spare = nil
+		return seg[:0]
+	}
+	return make([]byte, 0, s.segSize)
+}
+
+// evict drops the oldest segment.
+func (s *SegmentedByteRing) evict() {
+	s.spare = s.segs[0]
+	s.length -= len(s.segs[0])
+	s.segs[0] = nil
+	s.segs = s.segs[1:]
+}
+
+// copyAt copies bytes starting at a logical offset into dest.
+func (s *SegmentedByteRing) copyAt(dest []byte, offset int) int {
+	available := s.available()
+	if offset < 0 || offset >= available {
+		return 0
+	}
+	dest = dest[:min(len(dest), available-offset)]
+	// bytes of the first segment which are already overwritten
+	pos := s.length - available + offset
+	n := 0
+	for i := pos / s.segSize; n < len(dest); i++ {
+		n += copy(dest[n:], s.segs[i][pos%s.segSize:])
+		pos = 0
+	}
+	return n
+}
+
+// Copy copies a len(dest) bytes into dest shifted by offset.
+// Offset equal to 0 means the beginning of data (oldest data).
+func (s *SegmentedByteRing) Copy(dest []byte, offset int) int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.copyAt(dest, offset)
+}
+
+// Tail copies last len(dest) bytes into dest argument.
+func (s *SegmentedByteRing) Tail(dest []byte) int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	available := s.available()
+	if len(dest) > available {
+		dest = dest[:available]
+	}
+	return s.copyAt(dest, available-len(dest))
+}
+
+// Bytes returns a copy of all data, from the oldest to the newest.
+func (s *SegmentedByteRing) Bytes() []byte {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	d := make([]byte, s.available())
+	s.copyAt(d, 0)
+	return d
+}
+
+// WriteTo writes all data into provided writer, segment by segment. Unlike
+// ByteRing.WriteTo it holds the read lock while calling w.Write, to avoid
+// copying a large amount of data.
+func (s *SegmentedByteRing) WriteTo(w io.Writer) (int64, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	var n int64
+	skip := s.length - s.available()
+	for _, seg := range s.segs {
+		d := seg[min(skip, len(seg)):]
+		skip -= len(seg) - len(d)
+		if len(d) == 0 {
+			continue
+		}
+		k, err := w.Write(d)
+		n += int64(k)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Reset resets the state of SegmentedByteRing to empty, keeping one segment
+// for reuse.
+func (s *SegmentedByteRing) Reset() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for len(s.segs) > 0 {
+		s.evict()
+	}
+	s.segs = nil
+}
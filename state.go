@@ -0,0 +1,82 @@
+// Copyright 2015 to Paweł Szczur.  All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bytering
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrStateLost is returned by Restore if data of the state has been
+// overwritten or moved since the state was taken.
+var ErrStateLost = errors.New("bytering: state data was overwritten")
+
+// State holds positions of data in a ByteRing, see Snapshot.
+type State struct {
+	start, end int
+	full       bool
+	behind     int
+	written    uint64
+	epoch      uint64
+}
+
+// Snapshot returns the current positions of data in buffer, which can be
+// later restored with Restore. Data itself is not copied.
+func (b *ByteRing) Snapshot() State {
+	b.rlock()
+	defer b.runlock()
+	return State{
+		start:   b.start,
+		end:     b.end,
+		full:    b.full,
+		behind:  b.behind,
+		written: b.written,
+		epoch:   b.epoch,
+	}
+}
+
+// Restore reverts buffer to the positions saved by Snapshot, undoing all
+// reads and writes done since. It only recovers positions, if data of the
+// state has been overwritten since, e.g. by writing more than the free space
+// at the time of Snapshot, or moved by Reset, Resize, Fill, etc., it returns
+// ErrStateLost and doesn't change buffer. A successful Restore invalidates
+// all taken states, including s.
+func (b *ByteRing) Restore(s State) error {
+	b.lock()
+	defer b.unlock()
+	if s.epoch != b.epoch {
+		return ErrStateLost
+	}
+	available := s.end - s.start
+	if s.full {
+		available = b.capacity
+	} else if available < 0 {
+		available += b.capacity
+	}
+	free := b.capacity - available
+	w := b.written - s.written
+	if w > uint64(free) {
+		return ErrStateLost
+	}
+	b.start = s.start
+	b.end = s.end
+	b.full = s.full
+	b.behind = min(s.behind, free-int(w))
+	b.epoch++
+	b.gen++ // unread data written since the state is dropped
+	b.peekLost = true
+	b.lines.valid = false
+	b.signal()
+	return nil
+}
+
+// Dump returns a copy of the whole underlying slice together with the
+// internal positions, it's meant for tests and debugging. The oldest unread
+// byte is at (end + size - Available()) % size.
+func (b *ByteRing) Dump() (contents []byte, end int, full bool, size int) {
+	b.rlock()
+	defer b.runlock()
+	return bytes.Clone(b.b), b.end, b.full, b.capacity
+}